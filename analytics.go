@@ -0,0 +1,557 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultEffectiveRateLimit = 500
+	maxEffectiveRateLimit     = 5000
+
+	defaultMissedDays = 7
+	maxMissedDays     = 90
+
+	// refreshLogRetention covers the longest missed-opportunities window.
+	refreshLogRetention = maxMissedDays * 24 * time.Hour
+)
+
+type AnalyticsStore struct{ db *sql.DB }
+
+func NewAnalyticsStore(db *sql.DB) *AnalyticsStore { return &AnalyticsStore{db: db} }
+
+type EffectiveRateSubmission struct {
+	SubmissionID          string    `json:"submission_id"`
+	StudyID               string    `json:"study_id"`
+	StudyName             string    `json:"study_name"`
+	StudyType             string    `json:"study_type,omitempty"`
+	ResearcherID          string    `json:"researcher_id,omitempty"`
+	ResearcherName        string    `json:"researcher_name,omitempty"`
+	Status                string    `json:"status"`
+	ObservedAt            time.Time `json:"observed_at"`
+	Reward                apiMoney  `json:"reward"`
+	TimeTakenSeconds      int       `json:"time_taken_seconds"`
+	EstimatedSeconds      int       `json:"estimated_seconds,omitempty"`
+	AdvertisedHourly      *apiMoney `json:"advertised_hourly,omitempty"`
+	EffectiveHourly       apiMoney  `json:"effective_hourly"`
+	TimeDeltaSeconds      *int      `json:"time_delta_seconds,omitempty"`
+	TimeRatio             *float64  `json:"time_ratio,omitempty"`
+	EffectiveVsAdvertised *float64  `json:"effective_vs_advertised,omitempty"`
+}
+
+type EffectiveRateGroup struct {
+	Key                   string   `json:"key"`
+	Name                  string   `json:"name,omitempty"`
+	Currency              string   `json:"currency"`
+	Submissions           int      `json:"submissions"`
+	TotalReward           float64  `json:"total_reward"`
+	TotalSeconds          int      `json:"total_seconds"`
+	EffectiveHourly       float64  `json:"effective_hourly"`
+	AdvertisedHourly      *float64 `json:"advertised_hourly,omitempty"`
+	MeanTimeRatio         *float64 `json:"mean_time_ratio,omitempty"`
+	EffectiveVsAdvertised *float64 `json:"effective_vs_advertised,omitempty"`
+
+	advertisedSum   float64
+	advertisedCount int
+	ratioSum        float64
+	ratioCount      int
+}
+
+type EffectiveRateReport struct {
+	Submissions  []EffectiveRateSubmission `json:"submissions"`
+	ByResearcher []EffectiveRateGroup      `json:"by_researcher"`
+	ByStudyType  []EffectiveRateGroup      `json:"by_study_type"`
+}
+
+// submissionRatePayload picks the fields effective-rate analytics needs out of
+// a stored submission payload. time_taken is kept raw and parsed leniently.
+type submissionRatePayload struct {
+	TimeTaken        json.RawMessage                `json:"time_taken"`
+	SubmissionReward *apiMoney                      `json:"submission_reward"`
+	Study            submissionRatePayloadStudyInfo `json:"study"`
+}
+
+// effectiveRateStatuses are the statuses whose submissions count towards
+// effective rates: finished work that has been, or is about to be, paid.
+var effectiveRateStatuses = []string{"APPROVED", "AWAITING REVIEW"}
+
+type submissionRatePayloadStudyInfo struct {
+	Researcher participantSubmissionPublisher `json:"researcher"`
+}
+
+func (s *AnalyticsStore) GetEffectiveRates(limit int) (*EffectiveRateReport, error) {
+	limit = clamp(limit, defaultEffectiveRateLimit, maxEffectiveRateLimit)
+
+	// No LIMIT in SQL: rows without a usable time_taken or reward are skipped
+	// below, so the limit is applied to the rows that are kept.
+	args := make([]any, len(effectiveRateStatuses))
+	for index, status := range effectiveRateStatuses {
+		args[index] = status
+	}
+	rows, err := s.db.Query(
+		`SELECT s.submission_id, s.study_id, s.study_name, s.status, s.observed_at, s.payload_json, l.payload_json
+		 FROM submissions s
+		 LEFT JOIN studies_latest l ON l.study_id = s.study_id
+		 WHERE s.status IN (`+sqlPlaceholders(len(args))+`)
+		 ORDER BY s.observed_at DESC, s.submission_id DESC`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query effective rate submissions: %w", err)
+	}
+	defer rows.Close()
+
+	report := &EffectiveRateReport{
+		Submissions:  make([]EffectiveRateSubmission, 0),
+		ByResearcher: make([]EffectiveRateGroup, 0),
+		ByStudyType:  make([]EffectiveRateGroup, 0),
+	}
+	for len(report.Submissions) < limit && rows.Next() {
+		var (
+			item           EffectiveRateSubmission
+			observedAt     string
+			submissionJSON string
+			studyJSON      sql.NullString
+		)
+		if err := rows.Scan(&item.SubmissionID, &item.StudyID, &item.StudyName, &item.Status, &observedAt, &submissionJSON, &studyJSON); err != nil {
+			return nil, fmt.Errorf("scan effective rate submission: %w", err)
+		}
+		item.ObservedAt = parseTime(observedAt)
+
+		var payload submissionRatePayload
+		if err := json.Unmarshal([]byte(submissionJSON), &payload); err != nil {
+			continue
+		}
+		seconds, ok := parseTimeTakenSeconds(payload.TimeTaken)
+		if !ok || seconds <= 0 || payload.SubmissionReward == nil {
+			continue
+		}
+		item.TimeTakenSeconds = seconds
+		item.Reward = *payload.SubmissionReward
+		item.EffectiveHourly = apiMoney{
+			Amount:   roundTo(item.Reward.Amount*3600/float64(seconds), 2),
+			Currency: item.Reward.Currency,
+		}
+		item.ResearcherID = strings.TrimSpace(payload.Study.Researcher.ID)
+		item.ResearcherName = strings.TrimSpace(payload.Study.Researcher.Name)
+
+		if studyJSON.Valid && studyJSON.String != "" {
+			var study normalizedStudy
+			if err := json.Unmarshal([]byte(studyJSON.String), &study); err == nil {
+				applyAdvertisedRate(&item, study)
+			}
+		}
+
+		report.Submissions = append(report.Submissions, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate effective rate submissions: %w", err)
+	}
+
+	report.ByResearcher = groupEffectiveRates(report.Submissions, func(item EffectiveRateSubmission) (string, string) {
+		if item.ResearcherID == "" {
+			return "unknown", "Unknown Researcher"
+		}
+		return item.ResearcherID, item.ResearcherName
+	})
+	report.ByStudyType = groupEffectiveRates(report.Submissions, func(item EffectiveRateSubmission) (string, string) {
+		if item.StudyType == "" {
+			return "unknown", ""
+		}
+		return item.StudyType, ""
+	})
+	return report, nil
+}
+
+type MissedOpportunityQuery struct {
+	Since                time.Time
+	MinHourlyRewardMajor float64
+	MinRewardMajor       float64
+	RefreshGap           time.Duration
+}
+
+type MissedStudy struct {
+	StudyID                 string    `json:"study_id"`
+	Name                    string    `json:"name"`
+	Researcher              string    `json:"researcher,omitempty"`
+	Reward                  apiMoney  `json:"reward"`
+	AverageRewardPerHour    apiMoney  `json:"average_reward_per_hour"`
+	EstimatedCompletionTime int       `json:"estimated_completion_time"`
+	PublishedAt             string    `json:"published_at,omitempty"`
+	AppearedAt              time.Time `json:"appeared_at"`
+	DisappearedAt           time.Time `json:"disappeared_at"`
+	AvailableSeconds        int64     `json:"available_seconds"`
+	DetectionDelaySeconds   *int64    `json:"detection_delay_seconds,omitempty"`
+	LeadRefreshGapSeconds   *int64    `json:"lead_refresh_gap_seconds,omitempty"`
+	MaxRefreshGapSeconds    int64     `json:"max_refresh_gap_seconds"`
+	ExplainedByRefreshGap   bool      `json:"explained_by_refresh_gap"`
+}
+
+type availabilityEpisode struct {
+	studyID string
+	name    string
+	start   time.Time
+	end     time.Time
+}
+
+// GetMissedOpportunities lists availability episodes of studies above the
+// reward thresholds that came and went without any submission from us, and
+// checks the refresh log for a pause that would explain not seeing them.
+func (s *AnalyticsStore) GetMissedOpportunities(query MissedOpportunityQuery) ([]MissedStudy, error) {
+	episodes, err := s.loadAvailabilityEpisodes(query.Since)
+	if err != nil {
+		return nil, err
+	}
+
+	submitted, err := s.loadSubmittedStudyIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	// Include the refresh just before the window so the first episode has a
+	// lead gap to measure against.
+	refreshes, err := s.loadRefreshTimes(query.Since.Add(-time.Hour))
+	if err != nil {
+		return nil, err
+	}
+
+	missed := make([]MissedStudy, 0)
+	studies := map[string]*normalizedStudy{}
+	for _, episode := range episodes {
+		if _, ok := submitted[episode.studyID]; ok {
+			continue
+		}
+
+		study, ok := studies[episode.studyID]
+		if !ok {
+			study, err = s.loadLatestStudy(episode.studyID)
+			if err != nil {
+				return nil, err
+			}
+			studies[episode.studyID] = study
+		}
+		if study == nil {
+			continue
+		}
+		if study.AverageRewardPerHour.Amount/100 < query.MinHourlyRewardMajor &&
+			study.Reward.Amount/100 < query.MinRewardMajor {
+			continue
+		}
+
+		item := MissedStudy{
+			StudyID:                 episode.studyID,
+			Name:                    episode.name,
+			Researcher:              study.Researcher.Name,
+			Reward:                  study.Reward,
+			AverageRewardPerHour:    study.AverageRewardPerHour,
+			EstimatedCompletionTime: study.EstimatedCompletionTime,
+			PublishedAt:             study.PublishedAt,
+			AppearedAt:              episode.start,
+			DisappearedAt:           episode.end,
+			AvailableSeconds:        int64(episode.end.Sub(episode.start) / time.Second),
+		}
+		if publishedAt := parseTime(study.PublishedAt); !publishedAt.IsZero() && episode.start.After(publishedAt) {
+			delay := int64(episode.start.Sub(publishedAt) / time.Second)
+			item.DetectionDelaySeconds = &delay
+		}
+
+		lead, maxGap := refreshGapsAround(refreshes, episode.start, episode.end)
+		if lead >= 0 {
+			leadSeconds := int64(lead / time.Second)
+			item.LeadRefreshGapSeconds = &leadSeconds
+		}
+		item.MaxRefreshGapSeconds = int64(maxGap / time.Second)
+		item.ExplainedByRefreshGap = query.RefreshGap > 0 && (maxGap > query.RefreshGap || lead > query.RefreshGap)
+
+		missed = append(missed, item)
+	}
+
+	sort.Slice(missed, func(i, j int) bool {
+		return missed[i].AppearedAt.After(missed[j].AppearedAt)
+	})
+	return missed, nil
+}
+
+func (s *AnalyticsStore) loadAvailabilityEpisodes(since time.Time) ([]availabilityEpisode, error) {
+	rows, err := s.db.Query(
+		`SELECT study_id, study_name, event_type, observed_at
+		 FROM study_availability_events
+		 WHERE observed_at >= ? AND event_type IN ('available', 'reopened', 'unavailable')
+		 ORDER BY row_id ASC`,
+		formatTime(since),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query availability episodes: %w", err)
+	}
+	defer rows.Close()
+
+	open := map[string]availabilityEpisode{}
+	episodes := make([]availabilityEpisode, 0)
+	for rows.Next() {
+		var studyID, name, eventType, observedAt string
+		if err := rows.Scan(&studyID, &name, &eventType, &observedAt); err != nil {
+			return nil, fmt.Errorf("scan availability episode: %w", err)
+		}
+		at := parseTime(observedAt)
+		if eventType != "unavailable" {
+			open[studyID] = availabilityEpisode{studyID: studyID, name: name, start: at}
+			continue
+		}
+		episode, ok := open[studyID]
+		if !ok {
+			continue
+		}
+		delete(open, studyID)
+		episode.end = at
+		episodes = append(episodes, episode)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate availability episodes: %w", err)
+	}
+	return episodes, nil
+}
+
+func (s *AnalyticsStore) loadSubmittedStudyIDs() (map[string]struct{}, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT study_id FROM submissions`)
+	if err != nil {
+		return nil, fmt.Errorf("query submitted study ids: %w", err)
+	}
+	defer rows.Close()
+
+	ids := map[string]struct{}{}
+	for rows.Next() {
+		var studyID string
+		if err := rows.Scan(&studyID); err != nil {
+			return nil, fmt.Errorf("scan submitted study id: %w", err)
+		}
+		ids[studyID] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate submitted study ids: %w", err)
+	}
+	return ids, nil
+}
+
+func (s *AnalyticsStore) loadRefreshTimes(since time.Time) ([]time.Time, error) {
+	rows, err := s.db.Query(
+		`SELECT observed_at FROM studies_refresh_log WHERE observed_at >= ? AND status_code = 200 ORDER BY observed_at ASC`,
+		formatTime(since),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query refresh log: %w", err)
+	}
+	defer rows.Close()
+
+	times := make([]time.Time, 0)
+	for rows.Next() {
+		var observedAt string
+		if err := rows.Scan(&observedAt); err != nil {
+			return nil, fmt.Errorf("scan refresh log: %w", err)
+		}
+		times = append(times, parseTime(observedAt))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate refresh log: %w", err)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times, nil
+}
+
+func (s *AnalyticsStore) loadLatestStudy(studyID string) (*normalizedStudy, error) {
+	var payloadJSON string
+	err := s.db.QueryRow(`SELECT payload_json FROM studies_latest WHERE study_id = ?`, studyID).Scan(&payloadJSON)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load latest study %s: %w", studyID, err)
+	}
+	var study normalizedStudy
+	if err := json.Unmarshal([]byte(payloadJSON), &study); err != nil {
+		return nil, nil
+	}
+	return &study, nil
+}
+
+// refreshGapsAround returns the pause between the last refresh before start
+// and start itself (-1 when unknown), and the longest pause between
+// consecutive refreshes from that refresh until end.
+func refreshGapsAround(refreshes []time.Time, start, end time.Time) (time.Duration, time.Duration) {
+	first := sort.Search(len(refreshes), func(i int) bool { return !refreshes[i].Before(start) })
+	lead := time.Duration(-1)
+	if first > 0 {
+		lead = start.Sub(refreshes[first-1])
+		first--
+	}
+
+	var maxGap time.Duration
+	if lead > maxGap {
+		maxGap = lead
+	}
+	for i := first + 1; i < len(refreshes) && !refreshes[i-1].After(end); i++ {
+		upper := refreshes[i]
+		if upper.After(end) {
+			upper = end
+		}
+		if gap := upper.Sub(refreshes[i-1]); gap > maxGap {
+			maxGap = gap
+		}
+	}
+	return lead, maxGap
+}
+
+func applyAdvertisedRate(item *EffectiveRateSubmission, study normalizedStudy) {
+	item.StudyType = study.StudyType
+	if item.ResearcherID == "" {
+		item.ResearcherID = strings.TrimSpace(study.Researcher.ID)
+	}
+	if item.ResearcherName == "" {
+		item.ResearcherName = strings.TrimSpace(study.Researcher.Name)
+	}
+
+	if study.EstimatedCompletionTime > 0 {
+		item.EstimatedSeconds = study.EstimatedCompletionTime * 60
+		delta := item.TimeTakenSeconds - item.EstimatedSeconds
+		ratio := roundTo(float64(item.TimeTakenSeconds)/float64(item.EstimatedSeconds), 3)
+		item.TimeDeltaSeconds = &delta
+		item.TimeRatio = &ratio
+	}
+
+	if study.AverageRewardPerHour.Amount > 0 {
+		advertised := study.AverageRewardPerHour
+		item.AdvertisedHourly = &advertised
+		if advertised.Currency == "" || advertised.Currency == item.EffectiveHourly.Currency {
+			ratio := roundTo(item.EffectiveHourly.Amount/advertised.Amount, 3)
+			item.EffectiveVsAdvertised = &ratio
+		}
+	}
+}
+
+func groupEffectiveRates(
+	items []EffectiveRateSubmission,
+	keyFn func(EffectiveRateSubmission) (string, string),
+) []EffectiveRateGroup {
+	groups := map[string]*EffectiveRateGroup{}
+	for _, item := range items {
+		key, name := keyFn(item)
+		mapKey := key + "\x00" + item.Reward.Currency
+		group, ok := groups[mapKey]
+		if !ok {
+			group = &EffectiveRateGroup{Key: key, Name: name, Currency: item.Reward.Currency}
+			groups[mapKey] = group
+		}
+		if group.Name == "" {
+			group.Name = name
+		}
+
+		group.Submissions++
+		group.TotalReward += item.Reward.Amount
+		group.TotalSeconds += item.TimeTakenSeconds
+		if item.AdvertisedHourly != nil && item.AdvertisedHourly.Currency == item.Reward.Currency {
+			group.advertisedSum += item.AdvertisedHourly.Amount
+			group.advertisedCount++
+		}
+		if item.TimeRatio != nil {
+			group.ratioSum += *item.TimeRatio
+			group.ratioCount++
+		}
+	}
+
+	result := make([]EffectiveRateGroup, 0, len(groups))
+	for _, group := range groups {
+		if group.TotalSeconds > 0 {
+			group.EffectiveHourly = roundTo(group.TotalReward*3600/float64(group.TotalSeconds), 2)
+		}
+		if group.advertisedCount > 0 {
+			advertised := roundTo(group.advertisedSum/float64(group.advertisedCount), 2)
+			group.AdvertisedHourly = &advertised
+			if advertised > 0 {
+				ratio := roundTo(group.EffectiveHourly/advertised, 3)
+				group.EffectiveVsAdvertised = &ratio
+			}
+		}
+		if group.ratioCount > 0 {
+			ratio := roundTo(group.ratioSum/float64(group.ratioCount), 3)
+			group.MeanTimeRatio = &ratio
+		}
+		result = append(result, *group)
+	}
+
+	// Worst under-estimators first: highest mean actual/estimated time ratio.
+	sort.Slice(result, func(i, j int) bool {
+		ri, rj := ratioOrZero(result[i].MeanTimeRatio), ratioOrZero(result[j].MeanTimeRatio)
+		if ri != rj {
+			return ri > rj
+		}
+		if result[i].Submissions != result[j].Submissions {
+			return result[i].Submissions > result[j].Submissions
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+func ratioOrZero(v *float64) float64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+func parseTimeTakenSeconds(raw json.RawMessage) (int, bool) {
+	trimmed := strings.TrimSpace(string(raw))
+	if trimmed == "" || trimmed == "null" {
+		return 0, false
+	}
+
+	var number float64
+	if err := json.Unmarshal(raw, &number); err == nil {
+		return int(number), true
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return 0, false
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseFloat(text, 64); err == nil {
+		return int(seconds), true
+	}
+
+	// HH:MM:SS, optionally with fractional seconds and a leading "N day(s), ".
+	days := 0
+	if idx := strings.Index(text, ","); idx >= 0 {
+		dayPart := strings.Fields(text[:idx])
+		if len(dayPart) > 0 {
+			if parsed, err := strconv.Atoi(dayPart[0]); err == nil {
+				days = parsed
+			}
+		}
+		text = strings.TrimSpace(text[idx+1:])
+	}
+	parts := strings.Split(text, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	hours, errH := strconv.Atoi(parts[0])
+	minutes, errM := strconv.Atoi(parts[1])
+	seconds, errS := strconv.ParseFloat(parts[2], 64)
+	if errH != nil || errM != nil || errS != nil {
+		return 0, false
+	}
+	return days*86400 + hours*3600 + minutes*60 + int(seconds), true
+}
+
+func roundTo(value float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
@@ -1,6 +1,12 @@
 package main
 
+import (
+	"errors"
+	"net/http"
+)
+
 type apiError struct {
+	status  int
 	message string
 }
 
@@ -12,13 +18,24 @@ func (e *apiError) Error() string {
 }
 
 func badRequest(message string) *apiError {
-	return &apiError{message: message}
+	return &apiError{status: http.StatusBadRequest, message: message}
 }
 
 func serviceUnavailable(message string) *apiError {
-	return &apiError{message: message}
+	return &apiError{status: http.StatusServiceUnavailable, message: message}
 }
 
 func internalServerError(message string) *apiError {
-	return &apiError{message: message}
+	return &apiError{status: http.StatusInternalServerError, message: message}
+}
+
+// writeAPIError maps an ingest error to its HTTP status. Errors that are not
+// apiErrors are reported as a generic 500, as they are over the WebSocket.
+func writeAPIError(w http.ResponseWriter, err error) {
+	var typed *apiError
+	if errors.As(err, &typed) && typed != nil {
+		writeError(w, typed.status, typed.message, nil)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, "internal server error", nil)
 }
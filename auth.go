@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	pairingCodeTTL      = 10 * time.Minute
+	pairingCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	pairingCodeLength   = 8
+	apiTokenPrefix      = "pp_"
+
+	// tokenTouchInterval limits how often last_used_at is rewritten.
+	tokenTouchInterval = time.Minute
+)
+
+var (
+	errInvalidPairingCode = errors.New("pairing code is invalid, used or expired")
+	errTokenNotFound      = errors.New("token not found or already revoked")
+)
+
+// TokensStore keeps pairing codes and API tokens. Only SHA-256 hashes of
+// either are stored.
+type TokensStore struct{ db *sql.DB }
+
+func NewTokensStore(db *sql.DB) *TokensStore { return &TokensStore{db: db} }
+
+type APIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizePairingCode accepts codes typed in any case, with or without the
+// dash they are shown with.
+func normalizePairingCode(raw string) string {
+	replacer := strings.NewReplacer("-", "", " ", "")
+	return strings.ToUpper(replacer.Replace(strings.TrimSpace(raw)))
+}
+
+func formatPairingCode(code string) string {
+	return code[:pairingCodeLength/2] + "-" + code[pairingCodeLength/2:]
+}
+
+// CreatePairingCode stores a new one-time code and returns it formatted for
+// display.
+func (s *TokensStore) CreatePairingCode(now time.Time) (string, time.Time, error) {
+	random := make([]byte, pairingCodeLength)
+	if _, err := rand.Read(random); err != nil {
+		return "", time.Time{}, fmt.Errorf("generate pairing code: %w", err)
+	}
+	code := make([]byte, pairingCodeLength)
+	for i, b := range random {
+		code[i] = pairingCodeAlphabet[int(b)%len(pairingCodeAlphabet)]
+	}
+
+	expiresAt := now.Add(pairingCodeTTL).UTC()
+	if _, err := s.db.Exec(
+		`INSERT INTO pairing_codes (code_hash, created_at, expires_at) VALUES (?, ?, ?)`,
+		hashSecret(string(code)),
+		formatTime(now),
+		formatTime(expiresAt),
+	); err != nil {
+		return "", time.Time{}, fmt.Errorf("store pairing code: %w", err)
+	}
+	return formatPairingCode(string(code)), expiresAt, nil
+}
+
+// ExchangePairingCode spends a pairing code and returns a new token. The
+// token itself is only ever returned here.
+func (s *TokensStore) ExchangePairingCode(code, name string, now time.Time) (string, APIToken, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", APIToken{}, fmt.Errorf("generate token: %w", err)
+	}
+	token := apiTokenPrefix + hex.EncodeToString(random)
+	created := APIToken{Name: name, CreatedAt: now.UTC()}
+
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		codeHash := hashSecret(normalizePairingCode(code))
+		var expiresAt string
+		err := tx.QueryRow(`SELECT expires_at FROM pairing_codes WHERE code_hash = ?`, codeHash).Scan(&expiresAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errInvalidPairingCode
+		}
+		if err != nil {
+			return fmt.Errorf("load pairing code: %w", err)
+		}
+		if !now.Before(parseTime(expiresAt)) {
+			return errInvalidPairingCode
+		}
+
+		// Spending the code deletes it, along with any that have expired.
+		if _, err := tx.Exec(
+			`DELETE FROM pairing_codes WHERE code_hash = ? OR expires_at < ?`,
+			codeHash,
+			formatTime(now),
+		); err != nil {
+			return fmt.Errorf("spend pairing code: %w", err)
+		}
+		if err := tx.QueryRow(
+			`INSERT INTO api_tokens (name, token_hash, created_at) VALUES (?, ?, ?) RETURNING token_id`,
+			name,
+			hashSecret(token),
+			formatTime(now),
+		).Scan(&created.ID); err != nil {
+			return fmt.Errorf("insert token: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", APIToken{}, err
+	}
+	return token, created, nil
+}
+
+// Authenticate reports whether token is a live token and records its use.
+func (s *TokensStore) Authenticate(token string, now time.Time) (int64, bool, error) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return 0, false, nil
+	}
+
+	var id int64
+	var lastUsedAt sql.NullString
+	err := s.db.QueryRow(
+		`SELECT token_id, last_used_at FROM api_tokens WHERE token_hash = ? AND revoked_at IS NULL`,
+		hashSecret(token),
+	).Scan(&id, &lastUsedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("load token: %w", err)
+	}
+
+	if !lastUsedAt.Valid || now.Sub(parseTime(lastUsedAt.String)) >= tokenTouchInterval {
+		if _, err := s.db.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE token_id = ?`, formatTime(now), id); err != nil {
+			logWarn("auth.token_touch_failed", "token_id", id, "error", err)
+		}
+	}
+	return id, true, nil
+}
+
+func (s *TokensStore) List() ([]APIToken, error) {
+	rows, err := s.db.Query(
+		`SELECT token_id, name, created_at, last_used_at, revoked_at FROM api_tokens ORDER BY token_id ASC`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := make([]APIToken, 0)
+	for rows.Next() {
+		var token APIToken
+		var createdAt string
+		var lastUsedAt, revokedAt sql.NullString
+		if err := rows.Scan(&token.ID, &token.Name, &createdAt, &lastUsedAt, &revokedAt); err != nil {
+			return nil, fmt.Errorf("scan token: %w", err)
+		}
+		token.CreatedAt = parseTime(createdAt)
+		if lastUsedAt.Valid {
+			t := parseTime(lastUsedAt.String)
+			token.LastUsedAt = &t
+		}
+		if revokedAt.Valid {
+			t := parseTime(revokedAt.String)
+			token.RevokedAt = &t
+		}
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+func (s *TokensStore) Revoke(id int64, now time.Time) error {
+	result, err := s.db.Exec(
+		`UPDATE api_tokens SET revoked_at = ? WHERE token_id = ? AND revoked_at IS NULL`,
+		formatTime(now),
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("revoke token: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return errTokenNotFound
+	}
+	return nil
+}
+
+// CountInUse counts live tokens that a client has authenticated with at least
+// once. A token paired but never used does not count.
+func (s *TokensStore) CountInUse() (int, error) {
+	var count int
+	if err := s.db.QueryRow(
+		`SELECT COUNT(*) FROM api_tokens WHERE revoked_at IS NULL AND last_used_at IS NOT NULL`,
+	).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count tokens: %w", err)
+	}
+	return count, nil
+}
+
+// IsActive reports whether token id exists and has not been revoked.
+func (s *TokensStore) IsActive(id int64) (bool, error) {
+	var count int
+	if err := s.db.QueryRow(
+		`SELECT COUNT(*) FROM api_tokens WHERE token_id = ? AND revoked_at IS NULL`,
+		id,
+	).Scan(&count); err != nil {
+		return false, fmt.Errorf("check token: %w", err)
+	}
+	return count > 0, nil
+}
+
+// requestToken reads the bearer token. Browsers cannot set headers on a
+// WebSocket handshake, so upgrades may pass it as ?token= instead.
+func requestToken(r *http.Request) string {
+	if header := strings.TrimSpace(r.Header.Get("Authorization")); header != "" {
+		scheme, token, ok := strings.Cut(header, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return strings.TrimSpace(r.URL.Query().Get("token"))
+	}
+	return ""
+}
+
+func (s *Service) authEnabled() bool {
+	return s.config.AuthRequired && s.tokensStore != nil
+}
+
+type tokenIDContextKey struct{}
+
+// requestTokenID returns the id of the token that authenticated r, or zero
+// when auth is off.
+func requestTokenID(r *http.Request) int64 {
+	id, _ := r.Context().Value(tokenIDContextKey{}).(int64)
+	return id
+}
+
+// requireToken rejects requests without a live API token.
+func (s *Service) requireToken(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.authEnabled() {
+			handler(w, r)
+			return
+		}
+
+		token := requestToken(r)
+		if token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "missing token; pair this client via POST /pair", nil)
+			return
+		}
+		tokenID, ok, err := s.tokensStore.Authenticate(token, time.Now().UTC())
+		if err != nil {
+			logWarn("auth.check_failed", "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to check token", nil)
+			return
+		}
+		if !ok {
+			logWarn("auth.rejected", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, "invalid or revoked token", nil)
+			return
+		}
+		handler(w, r.WithContext(context.WithValue(r.Context(), tokenIDContextKey{}, tokenID)))
+	}
+}
+
+type pairRequest struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// handlePair exchanges a pairing code for a token. It is the one route that
+// works without a token.
+func (s *Service) handlePair(w http.ResponseWriter, r *http.Request) {
+	if s.tokensStore == nil {
+		writeError(w, http.StatusServiceUnavailable, "tokens store not configured", nil)
+		return
+	}
+
+	var request pairRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body", nil)
+		return
+	}
+	if normalizePairingCode(request.Code) == "" {
+		writeError(w, http.StatusBadRequest, "code is required", nil)
+		return
+	}
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		name = "unnamed client"
+	}
+
+	token, created, err := s.tokensStore.ExchangePairingCode(request.Code, name, time.Now().UTC())
+	if errors.Is(err, errInvalidPairingCode) {
+		logWarn("auth.pairing_failed", "remote_addr", r.RemoteAddr)
+		writeError(w, http.StatusForbidden, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		logWarn("auth.pairing_failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to pair client", nil)
+		return
+	}
+
+	logInfo("auth.paired", "token_id", created.ID, "name", created.Name, "remote_addr", r.RemoteAddr)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"token":      token,
+		"token_id":   created.ID,
+		"name":       created.Name,
+		"created_at": created.CreatedAt,
+	})
+}
+
+// announcePairing shows a pairing code at startup until some client has used
+// its token, so an install upgraded to auth can still pair its extension.
+func (s *Service) announcePairing() {
+	if !s.authEnabled() {
+		logWarn("auth.disabled", "reason", "PROLIFIC_PULSE_AUTH=false")
+		return
+	}
+
+	inUse, err := s.tokensStore.CountInUse()
+	if err != nil {
+		logWarn("auth.pairing_code_failed", "error", err)
+		return
+	}
+	if inUse > 0 {
+		logInfo("auth.enabled", "tokens_in_use", inUse, "hint", "run `prolific-pulse token pair` to pair another client")
+		return
+	}
+
+	code, expiresAt, err := s.tokensStore.CreatePairingCode(time.Now().UTC())
+	if err != nil {
+		logWarn("auth.pairing_code_failed", "error", err)
+		return
+	}
+	logInfo("auth.pairing_code", "code", code, "expires_at", expiresAt.Format(time.RFC3339), "hint", "enter it in the extension's settings tab")
+}
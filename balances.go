@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBalanceHistoryLimit = 100
+	maxBalanceHistoryLimit     = 5000
+
+	balanceChangeInitial      = "initial"
+	balanceChangePayout       = "payout"
+	balanceChangeApproval     = "approval"
+	balanceChangeBonus        = "bonus"
+	balanceChangePendingAdded = "pending_added"
+	balanceChangeOther        = "changed"
+)
+
+var errPartialBalance = errors.New("balance body lacks available or pending balance and there is no earlier balance to carry it over from")
+
+type BalancesStore struct{ db *sql.DB }
+
+func NewBalancesStore(db *sql.DB) *BalancesStore { return &BalancesStore{db: db} }
+
+type BalanceSnapshot struct {
+	Available      float64   `json:"available"`
+	Pending        float64   `json:"pending"`
+	Currency       string    `json:"currency"`
+	ObservedAt     time.Time `json:"observed_at"`
+	LastObservedAt time.Time `json:"last_observed_at"`
+
+	// A body may carry only one of the two balances. The missing one is
+	// taken from the latest stored snapshot rather than read as zero.
+	missingAvailable bool
+	missingPending   bool
+}
+
+type BalanceChange struct {
+	Kind            string           `json:"kind"`
+	Previous        *BalanceSnapshot `json:"previous,omitempty"`
+	Current         BalanceSnapshot  `json:"current"`
+	AvailableDelta  float64          `json:"available_delta"`
+	PendingDelta    float64          `json:"pending_delta"`
+	CurrencyChanged bool             `json:"currency_changed,omitempty"`
+}
+
+// balanceResponseBody accepts both the flat minor-unit numbers and the
+// {amount, currency} objects Prolific uses for balance fields.
+type balanceResponseBody struct {
+	Balance          json.RawMessage `json:"balance"`
+	AvailableBalance json.RawMessage `json:"available_balance"`
+	PendingBalance   json.RawMessage `json:"pending_balance"`
+	CurrencyCode     string          `json:"currency_code"`
+	Currency         string          `json:"currency"`
+}
+
+func decodeBalanceBody(response interceptedResponse) (BalanceSnapshot, error) {
+	if len(response.Body) == 0 {
+		return BalanceSnapshot{}, badRequest("body cannot be empty")
+	}
+
+	var body balanceResponseBody
+	if err := json.Unmarshal(response.Body, &body); err != nil {
+		return BalanceSnapshot{}, badRequest("invalid balance body")
+	}
+
+	currency := strings.TrimSpace(body.CurrencyCode)
+	if currency == "" {
+		currency = strings.TrimSpace(body.Currency)
+	}
+
+	available, availableCurrency, okAvailable := parseBalanceAmount(body.AvailableBalance)
+	if !okAvailable {
+		available, availableCurrency, okAvailable = parseBalanceAmount(body.Balance)
+	}
+	pending, pendingCurrency, okPending := parseBalanceAmount(body.PendingBalance)
+	if !okAvailable && !okPending {
+		return BalanceSnapshot{}, badRequest("balance body has no available or pending balance")
+	}
+	if currency == "" {
+		currency = availableCurrency
+	}
+	if currency == "" {
+		currency = pendingCurrency
+	}
+
+	observedAt := utcNowOr(response.ObservedAt)
+	return BalanceSnapshot{
+		Available:        available,
+		Pending:          pending,
+		Currency:         strings.ToUpper(currency),
+		ObservedAt:       observedAt,
+		LastObservedAt:   observedAt,
+		missingAvailable: !okAvailable,
+		missingPending:   !okPending,
+	}, nil
+}
+
+func parseBalanceAmount(raw json.RawMessage) (float64, string, bool) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return 0, "", false
+	}
+	var amount float64
+	if err := json.Unmarshal(trimmed, &amount); err == nil {
+		return amount, "", true
+	}
+	var money apiMoney
+	if err := json.Unmarshal(trimmed, &money); err == nil {
+		return money.Amount, money.Currency, true
+	}
+	return 0, "", false
+}
+
+// Record stores snapshot when it differs from the latest stored balance and
+// returns the change, or nil when only the last-observed time moved. A
+// balance missing from the body is filled in from the latest snapshot.
+func (s *BalancesStore) Record(snapshot *BalanceSnapshot) (*BalanceChange, error) {
+	snapshot.ObservedAt = utcNowOr(snapshot.ObservedAt)
+	snapshot.LastObservedAt = snapshot.ObservedAt
+
+	var change *BalanceChange
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		previous, rowID, err := latestBalance(tx)
+		if err != nil {
+			return err
+		}
+		if snapshot.missingAvailable || snapshot.missingPending {
+			if previous == nil {
+				return errPartialBalance
+			}
+			if snapshot.missingAvailable {
+				snapshot.Available = previous.Available
+			}
+			if snapshot.missingPending {
+				snapshot.Pending = previous.Pending
+			}
+		}
+
+		if previous != nil &&
+			previous.Available == snapshot.Available &&
+			previous.Pending == snapshot.Pending &&
+			previous.Currency == snapshot.Currency {
+			if _, err := tx.Exec(
+				`UPDATE balances SET last_observed_at = ? WHERE row_id = ?`,
+				formatTime(snapshot.ObservedAt),
+				rowID,
+			); err != nil {
+				return fmt.Errorf("touch balance: %w", err)
+			}
+			return nil
+		}
+
+		if _, err := tx.Exec(
+			`INSERT INTO balances (available, pending, currency, observed_at, last_observed_at)
+			 VALUES (?, ?, ?, ?, ?)`,
+			snapshot.Available,
+			snapshot.Pending,
+			snapshot.Currency,
+			formatTime(snapshot.ObservedAt),
+			formatTime(snapshot.LastObservedAt),
+		); err != nil {
+			return fmt.Errorf("insert balance: %w", err)
+		}
+
+		change = classifyBalanceChange(previous, *snapshot)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+func classifyBalanceChange(previous *BalanceSnapshot, current BalanceSnapshot) *BalanceChange {
+	change := &BalanceChange{Current: current, Kind: balanceChangeOther}
+	if previous == nil {
+		change.Kind = balanceChangeInitial
+		return change
+	}
+
+	change.Previous = previous
+	change.AvailableDelta = current.Available - previous.Available
+	change.PendingDelta = current.Pending - previous.Pending
+	change.CurrencyChanged = previous.Currency != current.Currency
+
+	switch {
+	case change.CurrencyChanged:
+	case change.AvailableDelta < 0:
+		change.Kind = balanceChangePayout
+	case change.AvailableDelta > 0 && change.PendingDelta < 0:
+		change.Kind = balanceChangeApproval
+	case change.AvailableDelta > 0:
+		change.Kind = balanceChangeBonus
+	case change.PendingDelta > 0:
+		change.Kind = balanceChangePendingAdded
+	}
+	return change
+}
+
+func latestBalance(tx *sql.Tx) (*BalanceSnapshot, int64, error) {
+	var (
+		rowID          int64
+		snapshot       BalanceSnapshot
+		observedAt     string
+		lastObservedAt string
+	)
+	err := tx.QueryRow(
+		`SELECT row_id, available, pending, currency, observed_at, last_observed_at
+		 FROM balances
+		 ORDER BY row_id DESC
+		 LIMIT 1`,
+	).Scan(&rowID, &snapshot.Available, &snapshot.Pending, &snapshot.Currency, &observedAt, &lastObservedAt)
+	if err == sql.ErrNoRows {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("load latest balance: %w", err)
+	}
+	snapshot.ObservedAt = parseTime(observedAt)
+	snapshot.LastObservedAt = parseTime(lastObservedAt)
+	return &snapshot, rowID, nil
+}
+
+func (s *BalancesStore) GetLatest() (*BalanceSnapshot, error) {
+	history, err := s.GetHistory(1)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return nil, nil
+	}
+	return &history[0], nil
+}
+
+func (s *BalancesStore) GetHistory(limit int) ([]BalanceSnapshot, error) {
+	limit = clamp(limit, defaultBalanceHistoryLimit, maxBalanceHistoryLimit)
+
+	rows, err := s.db.Query(
+		`SELECT available, pending, currency, observed_at, last_observed_at
+		 FROM balances
+		 ORDER BY row_id DESC
+		 LIMIT ?`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query balance history: %w", err)
+	}
+	defer rows.Close()
+
+	history := make([]BalanceSnapshot, 0, limit)
+	for rows.Next() {
+		var snapshot BalanceSnapshot
+		var observedAt, lastObservedAt string
+		if err := rows.Scan(&snapshot.Available, &snapshot.Pending, &snapshot.Currency, &observedAt, &lastObservedAt); err != nil {
+			return nil, fmt.Errorf("scan balance history: %w", err)
+		}
+		snapshot.ObservedAt = parseTime(observedAt)
+		snapshot.LastObservedAt = parseTime(lastObservedAt)
+		history = append(history, snapshot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate balance history: %w", err)
+	}
+	return history, nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Capture is one raw payload received from the extension. For intercepted
+// responses Body is the Prolific response body; for studies refreshes, which
+// carry no body, it is the refresh payload itself.
+type Capture struct {
+	RowID       int64
+	MessageType string
+	URL         string
+	StatusCode  int
+	ObservedAt  time.Time
+	Body        json.RawMessage
+}
+
+type CapturesStore struct{ db *sql.DB }
+
+func NewCapturesStore(db *sql.DB) *CapturesStore { return &CapturesStore{db: db} }
+
+func (s *CapturesStore) Record(capture Capture) error {
+	return s.RecordAll([]Capture{capture})
+}
+
+// RecordAll stores the captures in one transaction.
+func (s *CapturesStore) RecordAll(captures []Capture) error {
+	compressed := make([][]byte, len(captures))
+	for index, capture := range captures {
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+		if _, err := writer.Write(capture.Body); err != nil {
+			return fmt.Errorf("compress capture: %w", err)
+		}
+		if err := writer.Close(); err != nil {
+			return fmt.Errorf("compress capture: %w", err)
+		}
+		compressed[index] = buffer.Bytes()
+	}
+
+	return withTx(s.db, func(tx *sql.Tx) error {
+		for index, capture := range captures {
+			if _, err := tx.Exec(
+				`INSERT INTO captures (message_type, url, status_code, observed_at, body_gzip)
+				 VALUES (?, ?, ?, ?, ?)`,
+				capture.MessageType,
+				capture.URL,
+				capture.StatusCode,
+				formatTime(utcNowOr(capture.ObservedAt)),
+				compressed[index],
+			); err != nil {
+				return fmt.Errorf("insert capture: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// Prune deletes captures observed before cutoff.
+func (s *CapturesStore) Prune(cutoff time.Time) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM captures WHERE observed_at < ?`, formatTime(cutoff))
+	if err != nil {
+		return 0, fmt.Errorf("prune captures: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// Each calls fn for every capture in observed_at order, stopping at the first
+// error fn returns.
+func (s *CapturesStore) Each(fn func(Capture) error) error {
+	rows, err := s.db.Query(
+		`SELECT row_id, message_type, url, status_code, observed_at, body_gzip
+		 FROM captures
+		 ORDER BY observed_at ASC, row_id ASC`,
+	)
+	if err != nil {
+		return fmt.Errorf("query captures: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			capture    Capture
+			observedAt string
+			compressed []byte
+		)
+		if err := rows.Scan(&capture.RowID, &capture.MessageType, &capture.URL, &capture.StatusCode, &observedAt, &compressed); err != nil {
+			return fmt.Errorf("scan capture: %w", err)
+		}
+		capture.ObservedAt = parseTime(observedAt)
+
+		reader, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return fmt.Errorf("decompress capture %d: %w", capture.RowID, err)
+		}
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			return fmt.Errorf("decompress capture %d: %w", capture.RowID, err)
+		}
+		capture.Body = body
+
+		if err := fn(capture); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate captures: %w", err)
+	}
+	return nil
+}
+
+// recordCaptures stores captures and drops captures past the retention
+// window.
+func (s *Service) recordCaptures(captures ...Capture) {
+	if len(captures) == 0 {
+		return
+	}
+	if err := s.capturesStore.RecordAll(captures); err != nil {
+		logWarn("capture.persist_failed", "message_type", captures[0].MessageType, "url", captures[0].URL, "count", len(captures), "error", err)
+		return
+	}
+	if s.config.CaptureRetention <= 0 {
+		return
+	}
+	if _, err := s.capturesStore.Prune(time.Now().UTC().Add(-s.config.CaptureRetention)); err != nil {
+		logWarn("capture.prune_failed", "error", err)
+	}
+}
+
+func (s *Service) captureInterceptedResponse(messageType string, payload interceptedResponsePayload) {
+	if s.capturesStore == nil {
+		return
+	}
+	s.recordCaptures(interceptedCapture(messageType, payload))
+}
+
+func interceptedCapture(messageType string, payload interceptedResponsePayload) Capture {
+	return Capture{
+		MessageType: messageType,
+		URL:         payload.URL,
+		StatusCode:  payload.StatusCode,
+		ObservedAt:  payload.ObservedAt,
+		Body:        payload.Body,
+	}
+}
+
+func (s *Service) captureStudiesRefresh(payload StudiesRefreshUpdate) {
+	if s.capturesStore == nil {
+		return
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logWarn("capture.persist_failed", "message_type", wsTypeStudiesRefresh, "error", err)
+		return
+	}
+	s.recordCaptures(Capture{
+		MessageType: wsTypeStudiesRefresh,
+		URL:         payload.URL,
+		StatusCode:  payload.StatusCode,
+		ObservedAt:  payload.ObservedAt,
+		Body:        body,
+	})
+}
+
+// replayCapture feeds a capture through the same processor the original
+// WebSocket message reached.
+func (s *Service) replayCapture(capture Capture) (map[string]any, error) {
+	switch capture.MessageType {
+	case wsTypeStudiesRefresh:
+		var payload StudiesRefreshUpdate
+		if err := json.Unmarshal(capture.Body, &payload); err != nil {
+			return nil, badRequest("invalid studies refresh capture")
+		}
+		payload.ObservedAt = capture.ObservedAt
+		return s.processReceiveStudiesRefresh(payload)
+	case wsTypeInterceptedResponse, wsTypeStudiesResponse, wsTypeSubmission, wsTypeParticipantSubs:
+		payload := interceptedResponsePayload{
+			URL:        capture.URL,
+			StatusCode: capture.StatusCode,
+			ObservedAt: capture.ObservedAt,
+			Body:       capture.Body,
+		}
+		wsType := capture.MessageType
+		if wsType == wsTypeInterceptedResponse {
+			wsType = ""
+		}
+		return s.routeInterceptedResponse(payload, wsType)
+	default:
+		return nil, badRequest(fmt.Sprintf("unknown capture message type %q", capture.MessageType))
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// runCommand dispatches the CLI subcommands. It returns the process exit code.
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	switch args[0] {
+	case "report":
+		return runReportCommand(args[1:], stdout, stderr)
+	case "replay":
+		return runReplayCommand(args[1:], stdout, stderr)
+	case "renormalize":
+		return runRenormalizeCommand(args[1:], stdout, stderr)
+	case "token":
+		return runTokenCommand(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		printUsage(stdout)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+		printUsage(stderr)
+		return 2
+	}
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, `usage: prolific-pulse [command]
+
+Without a command the HTTP/WebSocket service is started.
+
+commands:
+  report daily [-date YYYY-MM-DD] [-format markdown|html] [-send] [-db path]
+  replay -db path [-from path] [-speed N]
+  renormalize [-history] [-db path]
+  token pair|list [-db path]
+  token revoke -id N [-db path]`)
+}
+
+func runReportCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "daily" {
+		fmt.Fprintln(stderr, "usage: report daily [-date YYYY-MM-DD] [-format markdown|html] [-send] [-db path]")
+		return 2
+	}
+
+	flags := flag.NewFlagSet("report daily", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	dateRaw := flags.String("date", "", "local calendar day to report on (default today)")
+	formatRaw := flags.String("format", reportFormatMarkdown, "output format: markdown or html")
+	send := flags.Bool("send", false, "also deliver the report through the configured notifier")
+	dbPath := flags.String("db", sqliteDBPath, "path to the SQLite database")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	format, ok := normalizeReportFormat(*formatRaw)
+	if !ok {
+		fmt.Fprintln(stderr, "format must be one of: markdown, html")
+		return 2
+	}
+	day, err := parseReportDate(*dateRaw)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	config := loadServiceConfig()
+	var sender notifier
+	if *send {
+		if sender = newNotifier(config); sender == nil {
+			fmt.Fprintln(stderr, errNotifierNotConfigured)
+			return 1
+		}
+	}
+
+	db, err := openSQLite(*dbPath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	report, err := NewAnalyticsStore(db).BuildDailyReport(day, config.PriorityFilter)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	rendered, err := renderDailyReport(report, format)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprint(stdout, rendered)
+	if !strings.HasSuffix(rendered, "\n") {
+		fmt.Fprintln(stdout)
+	}
+
+	if sender != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+		if err := sender.Notify(ctx, notification{
+			Title:  "Prolific Pulse daily digest " + report.Date,
+			Format: format,
+			Body:   rendered,
+		}); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// runReplayCommand re-runs archived captures, oldest first, through the ingest
+// processors into a fresh database. With -speed N the original gaps between
+// captures are kept, divided by N; by default captures run back to back.
+func runReplayCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	fromPath := flags.String("from", sqliteDBPath, "database holding the captures table")
+	dbPath := flags.String("db", "", "fresh database to replay into (must not exist)")
+	speed := flags.Float64("speed", 0, "replay speed multiplier; 0 replays without delays")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *dbPath == "" || *speed < 0 {
+		fmt.Fprintln(stderr, "usage: replay -db path [-from path] [-speed N]")
+		return 2
+	}
+	if _, err := os.Stat(*dbPath); err == nil {
+		fmt.Fprintf(stderr, "%s already exists; replay needs a fresh database\n", *dbPath)
+		return 1
+	} else if !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	source, err := openSQLiteReadOnly(*fromPath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer source.Close()
+
+	target, err := openSQLite(*dbPath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer target.Close()
+
+	config := loadServiceConfig()
+	service := NewService(
+		config,
+		NewStudiesStore(target),
+		NewSubmissionsStore(target),
+		NewServiceStateStore(target),
+		NewAnalyticsStore(target),
+		NewBalancesStore(target),
+		nil,
+		NewSchemaDriftStore(target),
+		nil,
+		nil,
+	)
+
+	var (
+		replayed int
+		failed   int
+		previous time.Time
+	)
+	err = NewCapturesStore(source).Each(func(capture Capture) error {
+		if *speed > 0 && !previous.IsZero() {
+			if gap := capture.ObservedAt.Sub(previous); gap > 0 {
+				time.Sleep(time.Duration(float64(gap) / *speed))
+			}
+		}
+		previous = capture.ObservedAt
+
+		if _, err := service.replayCapture(capture); err != nil {
+			failed++
+			fmt.Fprintf(stderr, "capture %d (%s %s): %s\n", capture.RowID, capture.MessageType, capture.URL, err)
+			return nil
+		}
+		replayed++
+		return nil
+	})
+	service.flushStudiesSession()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "replayed %d captures into %s (%d failed)\n", replayed, *dbPath, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runRenormalizeCommand rewrites normalized study payloads from the raw
+// Prolific objects stored next to them, e.g. after normalizedStudy gains
+// fields.
+func runRenormalizeCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("renormalize", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	history := flags.Bool("history", false, "also rewrite studies_history payloads")
+	dbPath := flags.String("db", sqliteDBPath, "path to the SQLite database")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	db, err := openSQLite(*dbPath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	counts, err := NewStudiesStore(db).Renormalize(*history)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "renormalized %d latest studies, %d enriched studies and %d history rows (%d skipped)\n", counts.Latest, counts.Enrichment, counts.History, counts.Skipped)
+	return 0
+}
+
+// runTokenCommand manages API tokens: pair prints a fresh pairing code, list
+// shows every token and revoke disables one.
+func runTokenCommand(args []string, stdout, stderr io.Writer) int {
+	const usage = "usage: token pair|list [-db path] | token revoke -id N [-db path]"
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("token "+args[0], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	dbPath := flags.String("db", sqliteDBPath, "path to the SQLite database")
+	id := flags.Int64("id", 0, "token id to revoke")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	db, err := openSQLite(*dbPath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer db.Close()
+	store := NewTokensStore(db)
+	now := time.Now().UTC()
+
+	switch args[0] {
+	case "pair":
+		code, expiresAt, err := store.CreatePairingCode(now)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "pairing code %s (expires %s)\n", code, expiresAt.Local().Format(time.Kitchen))
+		fmt.Fprintln(stdout, `exchange it with: curl -X POST -d '{"code":"`+code+`","name":"my client"}' localhost:8080/pair`)
+	case "list":
+		tokens, err := store.List()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		if len(tokens) == 0 {
+			fmt.Fprintln(stdout, "no tokens")
+			return 0
+		}
+		for _, token := range tokens {
+			state := "active"
+			if token.RevokedAt != nil {
+				state = "revoked " + token.RevokedAt.Local().Format(time.DateTime)
+			}
+			lastUsed := "never"
+			if token.LastUsedAt != nil {
+				lastUsed = token.LastUsedAt.Local().Format(time.DateTime)
+			}
+			fmt.Fprintf(stdout, "%d\t%s\tcreated %s\tlast used %s\t%s\n",
+				token.ID, token.Name, token.CreatedAt.Local().Format(time.DateTime), lastUsed, state)
+		}
+	case "revoke":
+		if *id <= 0 {
+			fmt.Fprintln(stderr, "usage: token revoke -id N [-db path]")
+			return 2
+		}
+		if err := store.Revoke(*id, now); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "revoked token %d\n", *id)
+	default:
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+	return 0
+}
@@ -1,5 +1,13 @@
 package main
 
+import (
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
 const (
 	listenAddr   = ":8080"
 	sqliteDBPath = "prolific_pulse.db"
@@ -7,4 +15,197 @@ const (
 	internalStudiesHost                = "internal-api.prolific.com"
 	internalStudiesPath                = "/api/v1/participant/studies/"
 	internalParticipantSubmissionsPath = "/api/v1/participant/submissions/"
+
+	defaultReopenFlickerWindow = 2 * time.Minute
+
+	// Priority filter defaults mirror the extension's DEFAULT_PRIORITY_FILTER_*.
+	defaultPriorityMinRewardMajor       = 0
+	defaultPriorityMinHourlyRewardMajor = 10
+	defaultPriorityMaxEstimatedMinutes  = 20
+	defaultPriorityMinPlacesAvailable   = 1
+
+	defaultMissedMinHourlyRewardMajor = 15
+	defaultMissedMinRewardMajor       = 5
+	defaultMissedRefreshGap           = 90 * time.Second
+
+	defaultMassDropRatio         = 0.5
+	defaultMassDropMinActive     = 3
+	defaultMassDropConfirmations = 2
+
+	defaultCaptureRetention = 14 * 24 * time.Hour
 )
+
+type serviceConfig struct {
+	// ReopenFlickerWindow is the shortest unavailable gap after which a
+	// reappearing study is announced again. Shorter gaps are flickers.
+	ReopenFlickerWindow time.Duration
+	PriorityFilter      priorityFilterConfig
+	NotifyWebhookURL    string
+
+	// A study counts as a missed opportunity when it clears either threshold.
+	MissedMinHourlyRewardMajor float64
+	MissedMinRewardMajor       float64
+	// MissedRefreshGap is the longest pause between studies refreshes that
+	// is considered normal cadence when explaining a miss.
+	MissedRefreshGap time.Duration
+
+	MassDrop massDropGuardConfig
+
+	// CaptureRaw archives every intercepted payload for the replay command.
+	// Captures older than CaptureRetention are deleted; zero keeps them all.
+	CaptureRaw       bool
+	CaptureRetention time.Duration
+
+	// WSQueueSize bounds each client's outbound queue; WSSlowConsumerPolicy
+	// decides what happens to broadcasts once it is full.
+	WSQueueSize          int
+	WSSlowConsumerPolicy string
+	// WSPingInterval is how long a client may stay silent before it is
+	// pinged. Zero disables pings.
+	WSPingInterval time.Duration
+
+	// DedupeWindow is how long processed message results are remembered for
+	// retries. Zero disables deduplication.
+	DedupeWindow time.Duration
+
+	// RefreshLeaderTimeout is how long the refresh leader may stay silent
+	// before another client takes over.
+	RefreshLeaderTimeout time.Duration
+
+	// AuthRequired makes every route except pairing demand an API token.
+	AuthRequired bool
+}
+
+// massDropGuardConfig decides when a full studies refresh that drops most of
+// the active studies is held back as suspect instead of being applied.
+type massDropGuardConfig struct {
+	// Ratio is the share of active studies a refresh must drop to be
+	// suspect. Zero disables the guard.
+	Ratio float64 `json:"ratio"`
+	// MinActive is the smallest active set the guard applies to.
+	MinActive int `json:"min_active"`
+	// Confirmations is how many suspect refreshes in a row are needed
+	// before the drop is accepted.
+	Confirmations int `json:"confirmations"`
+}
+
+// priorityFilterConfig is the numeric part of the extension's priority
+// filter, used server-side to judge which studies were worth taking.
+type priorityFilterConfig struct {
+	MinRewardMajor       float64 `json:"minimum_reward_major"`
+	MinHourlyRewardMajor float64 `json:"minimum_hourly_reward_major"`
+	MaxEstimatedMinutes  int     `json:"maximum_estimated_minutes"`
+	MinPlacesAvailable   int     `json:"minimum_places_available"`
+}
+
+func loadServiceConfig() serviceConfig {
+	return serviceConfig{
+		ReopenFlickerWindow: envDuration("PROLIFIC_PULSE_REOPEN_FLICKER_WINDOW", defaultReopenFlickerWindow),
+		PriorityFilter: priorityFilterConfig{
+			MinRewardMajor:       envFloat("PROLIFIC_PULSE_PRIORITY_MIN_REWARD", defaultPriorityMinRewardMajor),
+			MinHourlyRewardMajor: envFloat("PROLIFIC_PULSE_PRIORITY_MIN_HOURLY_REWARD", defaultPriorityMinHourlyRewardMajor),
+			MaxEstimatedMinutes:  envInt("PROLIFIC_PULSE_PRIORITY_MAX_ESTIMATED_MINUTES", defaultPriorityMaxEstimatedMinutes),
+			MinPlacesAvailable:   envInt("PROLIFIC_PULSE_PRIORITY_MIN_PLACES", defaultPriorityMinPlacesAvailable),
+		},
+		NotifyWebhookURL: strings.TrimSpace(os.Getenv("PROLIFIC_PULSE_NOTIFY_WEBHOOK_URL")),
+
+		MissedMinHourlyRewardMajor: envFloat("PROLIFIC_PULSE_MISSED_MIN_HOURLY_REWARD", defaultMissedMinHourlyRewardMajor),
+		MissedMinRewardMajor:       envFloat("PROLIFIC_PULSE_MISSED_MIN_REWARD", defaultMissedMinRewardMajor),
+		MissedRefreshGap:           envDuration("PROLIFIC_PULSE_MISSED_REFRESH_GAP", defaultMissedRefreshGap),
+
+		MassDrop: massDropGuardConfig{
+			Ratio:         envFloat("PROLIFIC_PULSE_MASS_DROP_RATIO", defaultMassDropRatio),
+			MinActive:     envInt("PROLIFIC_PULSE_MASS_DROP_MIN_ACTIVE", defaultMassDropMinActive),
+			Confirmations: envInt("PROLIFIC_PULSE_MASS_DROP_CONFIRMATIONS", defaultMassDropConfirmations),
+		},
+
+		CaptureRaw:       envBool("PROLIFIC_PULSE_CAPTURE_RAW", false),
+		CaptureRetention: envDuration("PROLIFIC_PULSE_CAPTURE_RETENTION", defaultCaptureRetention),
+
+		WSQueueSize:          envInt("PROLIFIC_PULSE_WS_QUEUE_SIZE", defaultWSQueueSize),
+		WSSlowConsumerPolicy: envChoice("PROLIFIC_PULSE_WS_SLOW_CONSUMER_POLICY", wsSlowConsumerPolicies, defaultWSSlowConsumerPolicy),
+		WSPingInterval:       envDuration("PROLIFIC_PULSE_WS_PING_INTERVAL", defaultWSPingInterval),
+
+		DedupeWindow:         envDuration("PROLIFIC_PULSE_DEDUPE_WINDOW", defaultDedupeWindow),
+		RefreshLeaderTimeout: envDuration("PROLIFIC_PULSE_REFRESH_LEADER_TIMEOUT", defaultRefreshLeaderTimeout),
+
+		AuthRequired: envBool("PROLIFIC_PULSE_AUTH", true),
+	}
+}
+
+func (f priorityFilterConfig) Matches(study normalizedStudy) bool {
+	if study.Reward.Amount/100 < f.MinRewardMajor {
+		return false
+	}
+	if study.AverageRewardPerHour.Amount/100 < f.MinHourlyRewardMajor {
+		return false
+	}
+	if study.EstimatedCompletionTime > f.MaxEstimatedMinutes {
+		return false
+	}
+	return study.PlacesAvailable >= f.MinPlacesAvailable
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil || parsed < 0 {
+		logWarn("config.invalid_duration", "key", key, "value", raw, "fallback", fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func envFloat(key string, fallback float64) float64 {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		logWarn("config.invalid_number", "key", key, "value", raw, "fallback", fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func envBool(key string, fallback bool) bool {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(raw)
+	if err != nil {
+		logWarn("config.invalid_bool", "key", key, "value", raw, "fallback", fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func envChoice(key string, choices []string, fallback string) string {
+	raw := strings.ToLower(strings.TrimSpace(os.Getenv(key)))
+	if raw == "" {
+		return fallback
+	}
+	if !slices.Contains(choices, raw) {
+		logWarn("config.invalid_choice", "key", key, "value", raw, "fallback", fallback)
+		return fallback
+	}
+	return raw
+}
+
+func envInt(key string, fallback int) int {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(raw)
+	if err != nil {
+		logWarn("config.invalid_integer", "key", key, "value", raw, "fallback", fallback)
+		return fallback
+	}
+	return parsed
+}
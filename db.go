@@ -3,6 +3,7 @@ package main
 import (
 	"database/sql"
 	"fmt"
+	"os"
 	"strings"
 
 	_ "modernc.org/sqlite"
@@ -38,6 +39,24 @@ func openSQLite(path string) (*sql.DB, error) {
 	return db, nil
 }
 
+// openSQLiteReadOnly opens an existing database for reading only, without
+// migrating it.
+func openSQLiteReadOnly(path string) (*sql.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+	return db, nil
+}
+
 func applyMigrations(db *sql.DB) error {
 	statements := []string{
 		`CREATE TABLE IF NOT EXISTS studies_latest (
@@ -61,7 +80,7 @@ func applyMigrations(db *sql.DB) error {
 			row_id INTEGER PRIMARY KEY AUTOINCREMENT,
 			study_id TEXT NOT NULL,
 			study_name TEXT NOT NULL,
-			event_type TEXT NOT NULL CHECK (event_type IN ('available', 'unavailable')),
+			event_type TEXT NOT NULL CHECK (event_type IN (` + availabilityEventTypesSQL() + `)),
 			observed_at TEXT NOT NULL
 		);`,
 		`CREATE TABLE IF NOT EXISTS service_state (
@@ -72,6 +91,72 @@ func applyMigrations(db *sql.DB) error {
 			last_studies_refresh_status INTEGER,
 			updated_at TEXT NOT NULL
 		);`,
+		`CREATE TABLE IF NOT EXISTS study_enrichment (
+			study_id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			payload_json TEXT NOT NULL,
+			detail_json TEXT NOT NULL,
+			enriched_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS studies_refresh_log (
+			row_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			observed_at TEXT NOT NULL,
+			source TEXT NOT NULL,
+			status_code INTEGER NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS balances (
+			row_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			available REAL NOT NULL,
+			pending REAL NOT NULL,
+			currency TEXT NOT NULL,
+			observed_at TEXT NOT NULL,
+			last_observed_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS captures (
+			row_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_type TEXT NOT NULL,
+			url TEXT NOT NULL,
+			status_code INTEGER NOT NULL,
+			observed_at TEXT NOT NULL,
+			body_gzip BLOB NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS schema_fields (
+			endpoint TEXT NOT NULL,
+			path TEXT NOT NULL,
+			json_type TEXT NOT NULL,
+			first_seen_at TEXT NOT NULL,
+			PRIMARY KEY (endpoint, path)
+		);`,
+		`CREATE TABLE IF NOT EXISTS schema_drift (
+			row_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			endpoint TEXT NOT NULL,
+			path TEXT NOT NULL,
+			change TEXT NOT NULL CHECK (change IN ('added', 'removed', 'type_changed')),
+			old_type TEXT NOT NULL,
+			new_type TEXT NOT NULL,
+			first_seen_at TEXT NOT NULL,
+			UNIQUE (endpoint, path, change, old_type, new_type)
+		);`,
+		`CREATE TABLE IF NOT EXISTS ws_events (
+			seq INTEGER PRIMARY KEY AUTOINCREMENT,
+			topic TEXT NOT NULL,
+			type TEXT NOT NULL,
+			message_json TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS api_tokens (
+			token_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			created_at TEXT NOT NULL,
+			last_used_at TEXT,
+			revoked_at TEXT
+		);`,
+		`CREATE TABLE IF NOT EXISTS pairing_codes (
+			code_hash TEXT PRIMARY KEY,
+			created_at TEXT NOT NULL,
+			expires_at TEXT NOT NULL
+		);`,
 		`CREATE TABLE IF NOT EXISTS submissions (
 			submission_id TEXT PRIMARY KEY,
 			study_id TEXT NOT NULL,
@@ -87,6 +172,8 @@ func applyMigrations(db *sql.DB) error {
 		`CREATE INDEX IF NOT EXISTS idx_studies_history_observed_at ON studies_history(observed_at);`,
 		`CREATE INDEX IF NOT EXISTS idx_study_availability_events_study_id ON study_availability_events(study_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_study_availability_events_observed_at ON study_availability_events(observed_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_studies_refresh_log_observed_at ON studies_refresh_log(observed_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_captures_observed_at ON captures(observed_at);`,
 		`CREATE INDEX IF NOT EXISTS idx_submissions_phase ON submissions(phase);`,
 		`CREATE INDEX IF NOT EXISTS idx_submissions_observed_at ON submissions(observed_at);`,
 	}
@@ -95,9 +182,18 @@ func applyMigrations(db *sql.DB) error {
 		return fmt.Errorf("apply migration: %w", err)
 	}
 
+	if err := migrateAvailabilityEventTypes(db); err != nil {
+		return err
+	}
+
 	// Additive column migrations — ignore "duplicate column" errors.
 	addColumnMigrations := []string{
 		`ALTER TABLE studies_active_snapshot ADD COLUMN first_seen_at TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE study_availability_events ADD COLUMN details_json TEXT`,
+		`ALTER TABLE studies_latest ADD COLUMN reopen_count INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE studies_latest ADD COLUMN raw_json TEXT`,
+		`ALTER TABLE studies_history ADD COLUMN raw_json TEXT`,
+		`ALTER TABLE submissions ADD COLUMN approved_at TEXT`,
 	}
 	for _, stmt := range addColumnMigrations {
 		if _, err := db.Exec(stmt); err != nil {
@@ -115,6 +211,102 @@ func applyMigrations(db *sql.DB) error {
 	return nil
 }
 
+// migrateAvailabilityEventTypes rebuilds study_availability_events when its
+// event_type CHECK constraint predates one of availabilityEventTypes. SQLite
+// cannot alter a CHECK in place, so the table is copied into a fresh one.
+func migrateAvailabilityEventTypes(db *sql.DB) error {
+	var tableSQL string
+	if err := db.QueryRow(
+		`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'study_availability_events'`,
+	).Scan(&tableSQL); err != nil {
+		return fmt.Errorf("load availability events schema: %w", err)
+	}
+
+	upToDate := true
+	for _, eventType := range availabilityEventTypes {
+		if !strings.Contains(tableSQL, "'"+eventType+"'") {
+			upToDate = false
+		}
+	}
+	if upToDate {
+		return nil
+	}
+
+	columns, err := tableColumns(db, "study_availability_events")
+	if err != nil {
+		return err
+	}
+
+	return withTx(db, func(tx *sql.Tx) error {
+		statements := []string{
+			`ALTER TABLE study_availability_events RENAME TO study_availability_events_old`,
+			`CREATE TABLE study_availability_events (
+				row_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				study_id TEXT NOT NULL,
+				study_name TEXT NOT NULL,
+				event_type TEXT NOT NULL CHECK (event_type IN (` + availabilityEventTypesSQL() + `)),
+				observed_at TEXT NOT NULL
+			)`,
+		}
+		names := make([]string, 0, len(columns))
+		for _, column := range columns {
+			names = append(names, column.name)
+			switch column.name {
+			case "row_id", "study_id", "study_name", "event_type", "observed_at":
+				continue
+			}
+			statements = append(statements, `ALTER TABLE study_availability_events ADD COLUMN `+column.name+` `+column.declType)
+		}
+		statements = append(statements,
+			`INSERT INTO study_availability_events (`+strings.Join(names, ", ")+`)
+			 SELECT `+strings.Join(names, ", ")+` FROM study_availability_events_old`,
+			`DROP TABLE study_availability_events_old`,
+			`CREATE INDEX IF NOT EXISTS idx_study_availability_events_study_id ON study_availability_events(study_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_study_availability_events_observed_at ON study_availability_events(observed_at)`,
+		)
+		for _, stmt := range statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				return fmt.Errorf("widen availability event types: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func availabilityEventTypesSQL() string {
+	quoted := make([]string, 0, len(availabilityEventTypes))
+	for _, eventType := range availabilityEventTypes {
+		quoted = append(quoted, "'"+eventType+"'")
+	}
+	return strings.Join(quoted, ", ")
+}
+
+type tableColumn struct {
+	name     string
+	declType string
+}
+
+func tableColumns(db *sql.DB, table string) ([]tableColumn, error) {
+	rows, err := db.Query(`SELECT name, type FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, fmt.Errorf("query %s columns: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns := make([]tableColumn, 0)
+	for rows.Next() {
+		var column tableColumn
+		if err := rows.Scan(&column.name, &column.declType); err != nil {
+			return nil, fmt.Errorf("scan %s column: %w", table, err)
+		}
+		columns = append(columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate %s columns: %w", table, err)
+	}
+	return columns, nil
+}
+
 func execStatements(db *sql.DB, statements ...string) error {
 	for _, stmt := range statements {
 		if _, err := db.Exec(stmt); err != nil {
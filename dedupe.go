@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDedupeWindow = 10 * time.Minute
+	maxDedupeEntries    = 2000
+
+	idempotencyKeyHeader = "Idempotency-Key"
+)
+
+type dedupeEntry struct {
+	hash     string
+	result   any
+	storedAt time.Time
+}
+
+// dedupeCache remembers the results of recently processed messages so a
+// retried message is answered with its original result instead of being
+// ingested again.
+type dedupeCache struct {
+	mu      sync.Mutex
+	window  time.Duration
+	entries map[string]dedupeEntry
+	hits    int
+	misses  int
+}
+
+func newDedupeCache(window time.Duration) *dedupeCache {
+	return &dedupeCache{window: window, entries: make(map[string]dedupeEntry)}
+}
+
+func (c *dedupeCache) enabled() bool {
+	return c != nil && c.window > 0
+}
+
+// lookup returns the stored result for key when the payload hash matches.
+// The same key with a different payload is treated as a new message.
+func (c *dedupeCache) lookup(key, hash string, now time.Time) (any, bool) {
+	if !c.enabled() || key == "" {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || now.Sub(entry.storedAt) > c.window {
+		c.misses++
+		return nil, false
+	}
+	if entry.hash != hash {
+		c.misses++
+		logWarn("dedupe.key_reused", "key", key)
+		return nil, false
+	}
+	c.hits++
+	return entry.result, true
+}
+
+func (c *dedupeCache) store(key, hash string, result any, now time.Time) {
+	if !c.enabled() || key == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = dedupeEntry{hash: hash, result: result, storedAt: now}
+	c.pruneLocked(now)
+}
+
+// pruneLocked drops expired entries and, past the size cap, the oldest ones.
+func (c *dedupeCache) pruneLocked(now time.Time) {
+	var oldestKey string
+	var oldestAt time.Time
+	for key, entry := range c.entries {
+		if now.Sub(entry.storedAt) > c.window {
+			delete(c.entries, key)
+			continue
+		}
+		if oldestKey == "" || entry.storedAt.Before(oldestAt) {
+			oldestKey, oldestAt = key, entry.storedAt
+		}
+	}
+	if len(c.entries) > maxDedupeEntries {
+		delete(c.entries, oldestKey)
+	}
+}
+
+func (c *dedupeCache) status() map[string]any {
+	if !c.enabled() {
+		return map[string]any{"enabled": false}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return map[string]any{
+		"enabled": true,
+		"window":  c.window.String(),
+		"entries": len(c.entries),
+		"hits":    c.hits,
+		"misses":  c.misses,
+	}
+}
+
+func payloadHash(kind string, payload []byte) string {
+	sum := sha256.New()
+	sum.Write([]byte(kind))
+	sum.Write([]byte{0})
+	sum.Write(bytes.TrimSpace(payload))
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// dedupeWSRequest answers a retried WS request from the cache, or processes
+// it and remembers a successful ack.
+func (s *Service) dedupeWSRequest(scope string, request wsClientMessage, process func() wsServerMessage) wsServerMessage {
+	key, hash := wsDedupeKey(scope, request)
+	if key == "" {
+		return process()
+	}
+
+	now := time.Now()
+	if cached, ok := s.lookupWSDuplicate(request, key, hash, now); ok {
+		return cached
+	}
+
+	response := process()
+	if response.OK {
+		s.dedupe.store(key, hash, response, now)
+	}
+	return response
+}
+
+// dedupeScope prefixes cache keys with the client's token, so one client's
+// ids never match another's. Without auth every client shares one scope:
+// a connection-scoped key would miss retries resent after a reconnect.
+func dedupeScope(tokenID int64) string {
+	if tokenID > 0 {
+		return "token:" + strconv.FormatInt(tokenID, 10)
+	}
+	return "open"
+}
+
+// wsDedupeKey returns the cache key and payload hash for request. A request
+// without an id is keyed by its type and payload. Queries are never
+// deduplicated, and neither is a batch: its items are deduplicated one by
+// one, so a retry may regroup them.
+func wsDedupeKey(scope string, request wsClientMessage) (string, string) {
+	requestType := strings.TrimSpace(request.Type)
+	if requestType == wsTypeBatch || slices.Contains(wsQueryTypes, requestType) {
+		return "", ""
+	}
+	hash := payloadHash(requestType, request.Payload)
+	if requestID := strings.TrimSpace(request.ID); requestID != "" {
+		return scope + ":ws:id:" + requestID, hash
+	}
+	return scope + ":ws:payload:" + hash, hash
+}
+
+func (s *Service) lookupWSDuplicate(request wsClientMessage, key, hash string, now time.Time) (wsServerMessage, bool) {
+	cached, ok := s.dedupe.lookup(key, hash, now)
+	if !ok {
+		return wsServerMessage{}, false
+	}
+	logInfo("dedupe.ws_duplicate", "type", strings.TrimSpace(request.Type), "id", strings.TrimSpace(request.ID))
+	return cached.(wsServerMessage), true
+}
+
+type idempotentHTTPResult struct {
+	status int
+	body   []byte
+}
+
+// idempotencyRecorder captures a handler's response so it can be replayed.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *idempotencyRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *idempotencyRecorder) Write(p []byte) (int, error) {
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
+
+// withIdempotencyKey replays the original response for a request that repeats
+// an Idempotency-Key with the same body. Only 2xx responses are remembered,
+// so a failed request can be retried.
+func (s *Service) withIdempotencyKey(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idempotencyKey := strings.TrimSpace(r.Header.Get(idempotencyKeyHeader))
+		if idempotencyKey == "" || !s.dedupe.enabled() {
+			handler(w, r)
+			return
+		}
+
+		body, err := readRequestBody(w, r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "failed to read request body", nil)
+			return
+		}
+
+		key := dedupeScope(requestTokenID(r)) + ":http:" + r.URL.Path + ":" + idempotencyKey
+		hash := payloadHash(r.URL.Path, body)
+		now := time.Now()
+		if cached, ok := s.dedupe.lookup(key, hash, now); ok {
+			result := cached.(idempotentHTTPResult)
+			logInfo("dedupe.http_duplicate", "path", r.URL.Path, "key", idempotencyKey)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(result.status)
+			_, _ = w.Write(result.body)
+			return
+		}
+
+		recorder := &idempotencyRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler(recorder, r)
+		if recorder.status >= 200 && recorder.status < 300 {
+			s.dedupe.store(key, hash, idempotentHTTPResult{status: recorder.status, body: recorder.body.Bytes()}, now)
+		}
+	}
+}
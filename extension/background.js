@@ -4,6 +4,7 @@ const PARTICIPANT_SUBMISSIONS_PATTERN = "*://internal-api.prolific.com/api/v1/pa
 const SUBMISSIONS_RESERVE_PATTERN = "*://internal-api.prolific.com/api/v1/submissions/reserve/*";
 const SUBMISSIONS_TRANSITION_PATTERN = "*://internal-api.prolific.com/api/v1/submissions/*/transition/*";
 const SUBMISSION_PATTERNS = [SUBMISSIONS_RESERVE_PATTERN, SUBMISSIONS_TRANSITION_PATTERN];
+const USER_BALANCE_PATTERN = "*://internal-api.prolific.com/api/v1/users/*/balance/*";
 const OAUTH_TOKEN_PATTERN = "*://auth.prolific.com/oauth/token*";
 
 const SERVICE_BASE_URL = "http://localhost:8080";
@@ -17,6 +18,12 @@ const SERVICE_WS_RECONNECT_MAX_DELAY_MS = 15_000;
 const SERVICE_WS_RECONNECT_JITTER_MS = 250;
 const SERVICE_WS_CONNECT_WAIT_MS = 1_500;
 const SERVICE_WS_CONNECT_POLL_MS = 50;
+const SERVICE_WS_REQUEST_TIMEOUT_MS = 10_000;
+const SERVICE_WS_PROTOCOL_VERSION = 1;
+const SERVICE_WS_OUTBOX_LIMIT = 500;
+const SERVICE_WS_OUTBOX_FLUSH_DELAY_MS = 50;
+const SERVICE_WS_CAPABILITIES = Object.freeze(["refresh-coordination"]);
+const SERVICE_WS_TOPICS = Object.freeze(["studies", "submissions"]);
 const TOKEN_SYNC_RETRY_DELAY_MS = 1_000;
 const DASHBOARD_DEFAULT_STUDIES_LIMIT = 50;
 const DASHBOARD_DEFAULT_EVENTS_LIMIT = 25;
@@ -24,11 +31,20 @@ const DASHBOARD_DEFAULT_SUBMISSIONS_LIMIT = 100;
 const DASHBOARD_MIN_LIMIT = 1;
 const DASHBOARD_MAX_LIMIT = 500;
 const SERVICE_WS_MESSAGE_TYPES = Object.freeze({
+  hello: "hello",
+  subscribe: "subscribe",
+  resume: "resume",
+  batch: "batch",
   studiesRefresh: "receive-studies-refresh",
   studiesResponse: "receive-studies-response",
   submissionResponse: "receive-submission-response",
   participantSubmissionsResponse: "receive-participant-submissions-response",
-  reportDebugState: "report-debug-state"
+  interceptedResponse: "receive-intercepted-response",
+  reportDebugState: "report-debug-state",
+  queryStatus: "query-status",
+  queryStudies: "query-studies",
+  queryEvents: "query-events",
+  querySubmissions: "query-submissions"
 });
 const SERVICE_WS_COMMANDS = Object.freeze({
   studiesRefresh: Object.freeze({
@@ -47,18 +63,29 @@ const SERVICE_WS_COMMANDS = Object.freeze({
     messageType: SERVICE_WS_MESSAGE_TYPES.participantSubmissionsResponse,
     errorPrefix: "Participant submissions response endpoint"
   }),
+  // The server routes these by URL, so new Prolific endpoints need no new
+  // message type.
+  interceptedResponse: Object.freeze({
+    messageType: SERVICE_WS_MESSAGE_TYPES.interceptedResponse,
+    errorPrefix: "Intercepted response endpoint"
+  }),
   reportDebugState: Object.freeze({
     messageType: SERVICE_WS_MESSAGE_TYPES.reportDebugState,
     errorPrefix: "Debug state report"
   })
 });
 const SERVICE_WS_SERVER_EVENT_TYPES = Object.freeze({
-  studiesRefreshEvent: "studies_refresh_event"
+  studiesRefreshEvent: "studies_refresh_event",
+  submissionUpdate: "submission_update",
+  refreshLead: "refresh-lead",
+  refreshStandby: "refresh-standby"
 });
 
 const STATE_KEY = "syncState";
 const PRIORITY_KNOWN_STUDIES_STATE_KEY = "priorityKnownStudiesState";
 const AUTO_OPEN_PROLIFIC_TAB_KEY = "autoOpenProlificTab";
+const SERVICE_AUTH_TOKEN_KEY = "serviceAuthToken";
+const SERVICE_WS_LAST_SEQ_KEY = "serviceSocketLastSeq";
 const AUTO_OPEN_PRIORITY_STUDIES_KEY = "autoOpenPriorityStudies";
 const PRIORITY_FILTER_AUTO_OPEN_NEW_TAB_KEY = "priorityFilterAutoOpenInNewTab";
 const PRIORITY_FILTER_ALERT_SOUND_ENABLED_KEY = "priorityFilterAlertSoundEnabled";
@@ -142,6 +169,7 @@ const STUDIES_COLLECTION_PATH = "/api/v1/participant/studies/";
 // TODO: Consider switching to api.prolific.com/?is_assistant=1 (used by Prolific Assistant extension).
 const FETCH_STUDIES_API_URL = "https://internal-api.prolific.com/api/v1/participant/studies/";
 const FETCH_STUDIES_EXT_MARKER = "_pwext";
+const STUDIES_MAX_FOLLOWED_PAGES = 20;
 
 function isExtensionOriginatedStudiesRequest(url) {
   try {
@@ -160,6 +188,7 @@ let studiesCompletedListenerRegistered = false;
 let studiesResponseCaptureRegistered = false;
 let submissionResponseCaptureRegistered = false;
 let participantSubmissionsResponseCaptureRegistered = false;
+let balanceResponseCaptureRegistered = false;
 let oauthCompletedListenerRegistered = false;
 let oauthResponseCaptureRegistered = false;
 let stateWriteQueue = Promise.resolve();
@@ -169,6 +198,19 @@ let serviceSocketReconnectTimer = null;
 let serviceSocketHeartbeatTimer = null;
 let serviceSocketReconnectAttempts = 0;
 let serviceSocketLastHeartbeatAckAt = 0;
+let serviceSocketMessageCounter = 0;
+let serviceSocketHello = null;
+let serviceSocketLastSeq = null;
+// While a resume is in flight, live events and replays can carry the same
+// seq; this holds the ones already handled.
+let serviceSocketResumeSeen = null;
+// "lead" or "standby" while the service coordinates refreshes, "" otherwise.
+let serviceRefreshRole = "";
+const serviceSocketPendingRequests = new Map();
+// Commands wait in the outbox until the server acks them. Entries keep their
+// id across reconnects, so a resent command is recognized as a retry.
+const serviceSocketOutbox = [];
+let serviceSocketOutboxTimer = null;
 let tokenSyncRetryTimer = null;
 let autoOpenInFlight = false;
 let lastAutoOpenedTabId = null;
@@ -321,11 +363,10 @@ function parseInternalAPIURL(raw) {
 }
 
 function notifyPopupDashboardUpdated(trigger, observedAt) {
-  const normalizedObservedAt = typeof observedAt === "string" ? observedAt.trim() : "";
   const payload = {
     action: "dashboardUpdated",
     trigger: String(trigger || "unknown"),
-    observed_at: normalizedObservedAt || nowIso()
+    observed_at: typeof observedAt === "string" ? observedAt.trim() : ""
   };
 
   try {
@@ -361,10 +402,59 @@ function clampDashboardLimit(value, fallback) {
   return Math.min(DASHBOARD_MAX_LIMIT, Math.max(DASHBOARD_MIN_LIMIT, parsed));
 }
 
+let serviceAuthToken = "";
+let serviceAuthTokenLoaded = false;
+// Connecting before the stored token is read would be rejected as
+// unauthenticated, so the socket and fetches wait for this.
+const serviceAuthTokenLoad = new Promise((resolve) => {
+  chrome.storage.local.get(SERVICE_AUTH_TOKEN_KEY, (data) => {
+    const stored = data && data[SERVICE_AUTH_TOKEN_KEY];
+    // A pairing that finished first already holds the newer token.
+    if (!serviceAuthToken && typeof stored === "string") {
+      serviceAuthToken = stored;
+    }
+    serviceAuthTokenLoaded = true;
+    resolve();
+  });
+});
+
+function serviceAuthHeaders() {
+  return serviceAuthToken ? { Authorization: `Bearer ${serviceAuthToken}` } : {};
+}
+
+// Browsers cannot set headers on a WebSocket handshake, so the token rides in
+// the query string.
+function serviceSocketURL() {
+  return serviceAuthToken
+    ? `${SERVICE_WS_URL}?token=${encodeURIComponent(serviceAuthToken)}`
+    : SERVICE_WS_URL;
+}
+
+async function pairWithService(code) {
+  const response = await fetch(`${SERVICE_BASE_URL}/pair`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ code, name: "Prolific Pulse extension" })
+  });
+  const body = await response.json().catch(() => ({}));
+  if (!response.ok || typeof body.token !== "string") {
+    throw new Error(body.error || `pairing failed: HTTP ${response.status}`);
+  }
+
+  serviceAuthToken = body.token;
+  await storageSetLocal({ [SERVICE_AUTH_TOKEN_KEY]: body.token });
+  await pushDebugLog("service.paired", { token_id: body.token_id });
+  if (serviceSocket) {
+    serviceSocket.close();
+  }
+  ensureServiceSocketConnected("service.paired");
+}
+
 async function fetchServiceJSON(path, contextLabel) {
+  await serviceAuthTokenLoad;
   let response;
   try {
-    response = await fetch(`${SERVICE_BASE_URL}${path}`);
+    response = await fetch(`${SERVICE_BASE_URL}${path}`, { headers: serviceAuthHeaders() });
   } catch (error) {
     const message = stringifyError(error);
     if (message === SERVICE_OFFLINE_MESSAGE) {
@@ -388,12 +478,41 @@ function extractArrayField(payload, key) {
   return payload[key];
 }
 
+// queryService reads dashboard data over the service socket once its hello
+// advertises queries, and over HTTP otherwise.
+async function queryService(messageType, params, path, contextLabel) {
+  const features = serviceSocketHello && serviceSocketHello.features;
+  if (!isServiceSocketReady() || !features || !features.queries) {
+    return fetchServiceJSON(path, contextLabel);
+  }
+  try {
+    return await requestServiceSocket(messageType, params);
+  } catch (error) {
+    throw new Error(`${contextLabel}: ${rawErrorMessage(error) || "socket error"}`);
+  }
+}
+
 async function loadDashboardData(liveLimit, eventsLimit, submissionsLimit) {
   const [refreshResult, studiesResult, eventsResult, submissionsResult] = await Promise.allSettled([
-    fetchServiceJSON("/studies-refresh", "Failed to fetch refresh state"),
-    fetchServiceJSON(`/studies?limit=${liveLimit}`, "Failed to fetch live studies"),
-    fetchServiceJSON(`/study-events?limit=${eventsLimit}`, "Failed to fetch study events"),
-    fetchServiceJSON(`/submissions?phase=all&limit=${submissionsLimit}`, "Failed to fetch submissions")
+    queryService(SERVICE_WS_MESSAGE_TYPES.queryStatus, {}, "/studies-refresh", "Failed to fetch refresh state"),
+    queryService(
+      SERVICE_WS_MESSAGE_TYPES.queryStudies,
+      { limit: liveLimit },
+      `/studies?limit=${liveLimit}`,
+      "Failed to fetch live studies"
+    ),
+    queryService(
+      SERVICE_WS_MESSAGE_TYPES.queryEvents,
+      { limit: eventsLimit },
+      `/study-events?limit=${eventsLimit}`,
+      "Failed to fetch study events"
+    ),
+    queryService(
+      SERVICE_WS_MESSAGE_TYPES.querySubmissions,
+      { phase: "all", limit: submissionsLimit },
+      `/submissions?phase=all&limit=${submissionsLimit}`,
+      "Failed to fetch submissions"
+    )
   ]);
 
   const parseResult = (result, extractor) => {
@@ -712,6 +831,42 @@ function normalizeParticipantSubmissionsURL(raw) {
   return parsed.toString();
 }
 
+// normalizeStudyDetailURL matches the page-level request for one study,
+// which the studies capture listener sees alongside the collection.
+function normalizeStudyDetailURL(raw) {
+  const parsed = parseInternalAPIURL(raw);
+  if (!parsed) {
+    return "";
+  }
+
+  const path = parsed.pathname.replace(/\/+$/, "/");
+  const detailMatch = path.match(/^\/api\/v1\/participant\/studies\/([^/]+)\/$/);
+  if (!detailMatch || !detailMatch[1]) {
+    return "";
+  }
+
+  parsed.pathname = `/api/v1/participant/studies/${detailMatch[1]}/`;
+  parsed.search = "";
+  return parsed.toString();
+}
+
+function normalizeUserBalanceURL(raw) {
+  const parsed = parseInternalAPIURL(raw);
+  if (!parsed) {
+    return "";
+  }
+
+  const path = parsed.pathname.replace(/\/+$/, "/");
+  const balanceMatch = path.match(/^\/api\/v1\/users\/([^/]+)\/balance\/$/);
+  if (!balanceMatch || !balanceMatch[1]) {
+    return "";
+  }
+
+  parsed.pathname = `/api/v1/users/${balanceMatch[1]}/balance/`;
+  parsed.search = "";
+  return parsed.toString();
+}
+
 async function extractTokenFromTab(tabId) {
   try {
     const results = await chrome.scripting.executeScript({
@@ -775,12 +930,12 @@ async function extractTokenFromTab(tabId) {
 // MAIN-world studies fetch (runs inside the open Prolific tab)
 // ---------------------------------------------------------------------------
 
-async function fetchStudiesInTab(tabId) {
+async function fetchStudiesInTab(tabId, apiURL = FETCH_STUDIES_API_URL) {
   // Prefer scripting mode: the request runs inside the Prolific tab's context,
   // so it carries normal cookies/origin and is indistinguishable from the web
   // app's own API calls. Fall back to background fetch only if scripting fails
   // (tab navigating, dead context, etc.).
-  const scriptResult = await fetchStudiesInTabViaScripting(tabId);
+  const scriptResult = await fetchStudiesInTabViaScripting(tabId, apiURL);
   if (scriptResult.ok) return scriptResult;
 
   // Scripting failed — try background fetch with stored token
@@ -799,7 +954,7 @@ async function fetchStudiesInTab(tabId) {
     tab_id: tabId
   });
 
-  const fetchURL = FETCH_STUDIES_API_URL + "?" + FETCH_STUDIES_EXT_MARKER + "=1";
+  const fetchURL = apiURL + (apiURL.includes("?") ? "&" : "?") + FETCH_STUDIES_EXT_MARKER + "=1";
   try {
     const resp = await fetch(fetchURL, {
       method: "GET",
@@ -816,7 +971,7 @@ async function fetchStudiesInTab(tabId) {
   }
 }
 
-async function fetchStudiesInTabViaScripting(tabId) {
+async function fetchStudiesInTabViaScripting(tabId, apiURL) {
   try {
     const results = await chrome.scripting.executeScript({
       target: { tabId },
@@ -873,7 +1028,7 @@ async function fetchStudiesInTabViaScripting(tabId) {
           return { ok: false, error: String(err) };
         }
       },
-      args: [FETCH_STUDIES_API_URL]
+      args: [apiURL]
     });
 
     if (!results || !results.length || !results[0].result) {
@@ -885,6 +1040,76 @@ async function fetchStudiesInTabViaScripting(tabId) {
   }
 }
 
+// The service only marks studies unavailable once it has seen every page of a
+// paginated listing, so the extension follows _links.next itself rather than
+// relying on the web app to load the later pages.
+function studiesNextPageURL(body, currentURL) {
+  const href = body && body._links && body._links.next && body._links.next.href;
+  if (typeof href !== "string" || !href) {
+    return "";
+  }
+  try {
+    return normalizeStudiesCollectionURL(new URL(href, currentURL).toString());
+  } catch {
+    return "";
+  }
+}
+
+function isFirstStudiesPage(url) {
+  try {
+    const page = new URL(url).searchParams.get("page");
+    return !page || page === "1";
+  } catch {
+    return false;
+  }
+}
+
+async function fetchRemainingStudiesPages(tabId, firstURL, firstBody, triggerSource) {
+  let currentURL = firstURL;
+  let body = firstBody;
+  for (let fetched = 0; fetched < STUDIES_MAX_FOLLOWED_PAGES; fetched++) {
+    const nextURL = studiesNextPageURL(body, currentURL);
+    if (!nextURL) {
+      return;
+    }
+
+    const result = await fetchStudiesInTab(tabId, nextURL);
+    if (!result.ok || result.status_code !== 200) {
+      pushDebugLog("studies.pages.fetch_failed", {
+        trigger_source: triggerSource,
+        url: nextURL,
+        status_code: result.status_code,
+        error: result.error
+      });
+      return;
+    }
+    try {
+      body = JSON.parse(result.body);
+    } catch (parseErr) {
+      pushDebugLog("studies.pages.body_parse_error", {
+        trigger_source: triggerSource,
+        url: nextURL,
+        error: String(parseErr)
+      });
+      return;
+    }
+
+    await sendServiceCommandByName("studiesResponse", {
+      url: nextURL,
+      status_code: result.status_code,
+      observed_at: nowIso(),
+      body
+    });
+    bumpCounter("studies_page_follow_count", 1);
+    currentURL = nextURL;
+  }
+  pushDebugLog("studies.pages.limit_reached", {
+    trigger_source: triggerSource,
+    url: currentURL,
+    limit: STUDIES_MAX_FOLLOWED_PAGES
+  });
+}
+
 // ---------------------------------------------------------------------------
 // Delayed refresh scheduling (ported from auto_refresh.go)
 // ---------------------------------------------------------------------------
@@ -1055,6 +1280,16 @@ async function runDelayedRefresh(triggerSource, generation, runIndex, runTotal)
       if (snapshotEvent) {
         queuePrioritySnapshotEvent(snapshotEvent);
       }
+
+      try {
+        await fetchRemainingStudiesPages(tabId, normalizedURL, parsedBody, triggerSource);
+      } catch (err) {
+        pushDebugLog("refresh.delayed.send_page_error", {
+          trigger_source: triggerSource,
+          run_index: runIndex,
+          error: stringifyError(err)
+        });
+      }
     }
   }
 
@@ -1082,6 +1317,11 @@ async function runDelayedRefresh(triggerSource, generation, runIndex, runTotal)
 }
 
 function scheduleDelayedRefreshes(triggerSource, policy) {
+  // Another connected browser is refreshing; this one waits for refresh-lead.
+  if (serviceRefreshRole === "standby") {
+    pushDebugLog("refresh.delayed.skip_standby", { trigger_source: triggerSource });
+    return;
+  }
   cancelDelayedRefreshes("reschedule:" + triggerSource);
   const currentGen = delayedRefreshGeneration;
   const delays = planDelayedRefreshSchedule(policy);
@@ -1137,11 +1377,9 @@ function sendDebugStateReport() {
       sync_state: stateWithoutLogs,
       debug_log_count: Array.isArray(debug_logs) ? debug_logs.length : 0
     };
-    try {
-      queueServiceSocketMessage(SERVICE_WS_MESSAGE_TYPES.reportDebugState, payload);
-    } catch {
+    sendServiceCommandByName("reportDebugState", payload).catch(() => {
       // Best effort — server may not be ready.
-    }
+    });
   });
 }
 
@@ -1263,6 +1501,11 @@ function ensureServiceSocketConnected(reason) {
     return;
   }
 
+  if (!serviceAuthTokenLoaded) {
+    serviceAuthTokenLoad.then(() => ensureServiceSocketConnected(reason));
+    return;
+  }
+
   if (serviceSocket && serviceSocket.readyState === WebSocket.CONNECTING) {
     return;
   }
@@ -1274,7 +1517,7 @@ function ensureServiceSocketConnected(reason) {
 
   let socket;
   try {
-    socket = new WebSocket(SERVICE_WS_URL);
+    socket = new WebSocket(serviceSocketURL());
   } catch {
     scheduleServiceSocketReconnect("connect_constructor_failed");
     return;
@@ -1294,6 +1537,7 @@ function ensureServiceSocketConnected(reason) {
     pushDebugLog("service.ws.connected", { reason });
     clearTransientServiceConnectingState();
     startServiceSocketHeartbeatLoop();
+    sendServiceSocketHello(socket);
     scheduleTokenSyncRetry("service.ws.connected", 0);
     scheduleDebugStateReport();
   };
@@ -1316,14 +1560,38 @@ function ensureServiceSocketConnected(reason) {
       return;
     }
 
+    if (!acceptServiceSocketSeq(parsed.seq)) {
+      return;
+    }
+
     if (messageType === SERVICE_WS_SERVER_EVENT_TYPES.studiesRefreshEvent) {
       const observedAt = extractObservedAtFromStudiesRefreshEvent(parsed);
-      notifyPopupDashboardUpdated("service.ws.studies_refresh_event", observedAt);
+      notifyPopupDashboardUpdated("service.ws.studies_refresh_event", observedAt || nowIso());
       queuePrioritySnapshotEvent(priorityAdapters.extractPrioritySnapshotEventFromStudiesRefreshMessage(parsed, extractObservedAtFromStudiesRefreshEvent));
       return;
     }
 
+    // Submission updates do not move the studies "Updated" time, so the
+    // popup only reloads.
+    if (messageType === SERVICE_WS_SERVER_EVENT_TYPES.submissionUpdate) {
+      notifyPopupDashboardUpdated("service.ws.submission_update", "");
+      return;
+    }
+
+    if (messageType === SERVICE_WS_SERVER_EVENT_TYPES.refreshLead) {
+      setServiceRefreshRole("lead", parsed.data);
+      return;
+    }
+
+    if (messageType === SERVICE_WS_SERVER_EVENT_TYPES.refreshStandby) {
+      setServiceRefreshRole("standby", parsed.data);
+      return;
+    }
+
     if (messageType === "ack") {
+      if (settleServiceSocketRequest(parsed)) {
+        return;
+      }
       if (parsed.ok === false) {
         const errorMessage = typeof parsed.error === "string" && parsed.error
           ? parsed.error
@@ -1347,30 +1615,80 @@ function ensureServiceSocketConnected(reason) {
     pushDebugLog("service.ws.error", { reason });
   };
 
-  socket.onclose = () => {
+  socket.onclose = (event) => {
     if (serviceSocket !== socket) {
       return;
     }
 
     serviceSocket = null;
+    serviceSocketHello = null;
+    serviceSocketResumeSeen = null;
     serviceSocketConnectInFlight = false;
     stopServiceSocketHeartbeatLoop();
+    rejectPendingServiceSocketRequests(SERVICE_OFFLINE_MESSAGE);
+    // Without the service there is no election, so a standby refreshes again.
+    setServiceRefreshRole("", null);
     updateServiceSocketState(false, "disconnected");
-    pushDebugLog("service.ws.disconnected", { reason });
+    pushDebugLog("service.ws.disconnected", { reason, close_reason: event.reason || "" });
     scheduleServiceSocketReconnect("background_keepalive");
   };
 }
 
-function queueServiceSocketMessage(messageType, payload) {
+// setServiceRefreshRole applies a refresh-lead or refresh-standby from the
+// service. A standby drops its scheduled refreshes; becoming lead again, or
+// losing the socket, schedules a fresh round.
+function setServiceRefreshRole(role, data) {
+  const previousRole = serviceRefreshRole;
+  serviceRefreshRole = role;
+  if (role === previousRole) {
+    return;
+  }
+
+  const details = data || {};
+  setState({
+    service_refresh_role: role,
+    service_refresh_term: Number.isInteger(details.term) ? details.term : null,
+    service_refresh_leader_id: Number.isInteger(details.leader_client_id) ? details.leader_client_id : null
+  });
+  pushDebugLog("service.refresh_role", {
+    role: role || "none",
+    previous_role: previousRole || "none",
+    term: details.term || 0,
+    leader_client_id: details.leader_client_id || 0
+  });
+
+  if (role === "standby") {
+    cancelDelayedRefreshes("service.refresh_standby");
+    return;
+  }
+  if (previousRole === "standby") {
+    getStudiesRefreshPolicySettings()
+      .then((policy) => scheduleDelayedRefreshes(role ? "service.refresh_lead" : "service.ws.disconnected", policy))
+      .catch((error) => {
+        pushDebugLog("refresh.delayed.resume_error", { error: stringifyError(error) });
+      });
+  }
+}
+
+function nextServiceSocketMessageID() {
+  serviceSocketMessageCounter += 1;
+  return `ext-${Date.now().toString(36)}-${serviceSocketMessageCounter}`;
+}
+
+function queueServiceSocketMessage(messageType, payload, messageID = "") {
   if (!messageType) {
     throw new Error("missing websocket message type");
   }
 
-  const encoded = JSON.stringify({
+  const message = {
     type: messageType,
     sent_at: nowIso(),
     payload
-  });
+  };
+  if (messageID) {
+    message.id = messageID;
+  }
+  const encoded = JSON.stringify(message);
 
   if (!isServiceSocketReady()) {
     throw new Error(SERVICE_CONNECTING_MESSAGE);
@@ -1391,18 +1709,189 @@ function queueServiceSocketMessage(messageType, payload) {
   }
 }
 
+// requestServiceSocket sends a message with an id and resolves with the data
+// of the matching ack, or rejects with its error.
+function requestServiceSocket(messageType, payload, messageID = nextServiceSocketMessageID()) {
+  return new Promise((resolve, reject) => {
+    const timer = setTimeout(() => {
+      serviceSocketPendingRequests.delete(messageID);
+      reject(new Error(`${messageType} timed out`));
+    }, SERVICE_WS_REQUEST_TIMEOUT_MS);
+    serviceSocketPendingRequests.set(messageID, { resolve, reject, timer });
+    try {
+      queueServiceSocketMessage(messageType, payload, messageID);
+    } catch (error) {
+      clearTimeout(timer);
+      serviceSocketPendingRequests.delete(messageID);
+      reject(error);
+    }
+  });
+}
+
+function settleServiceSocketRequest(ack) {
+  const pending = typeof ack.id === "string" ? serviceSocketPendingRequests.get(ack.id) : null;
+  if (!pending) {
+    return false;
+  }
+  serviceSocketPendingRequests.delete(ack.id);
+  clearTimeout(pending.timer);
+  // Error acks leave ok out rather than send false.
+  if (ack.ok !== true) {
+    const error = new Error(typeof ack.error === "string" && ack.error ? ack.error : "request failed");
+    error.data = ack.data || {};
+    pending.reject(error);
+  } else {
+    pending.resolve(ack.data || {});
+  }
+  return true;
+}
+
+async function loadServiceSocketLastSeq() {
+  if (serviceSocketLastSeq === null) {
+    const stored = await chrome.storage.local.get(SERVICE_WS_LAST_SEQ_KEY);
+    const seq = stored[SERVICE_WS_LAST_SEQ_KEY];
+    serviceSocketLastSeq = Number.isInteger(seq) && seq >= 0 ? seq : -1;
+  }
+  return serviceSocketLastSeq;
+}
+
+function saveServiceSocketLastSeq(seq) {
+  serviceSocketLastSeq = seq;
+  storageSetLocal({ [SERVICE_WS_LAST_SEQ_KEY]: seq }).catch(() => {
+    // Best effort; a lost seq only costs a resync.
+  });
+}
+
+// acceptServiceSocketSeq records the seq of a pushed event and reports
+// whether the event is new.
+function acceptServiceSocketSeq(seq) {
+  if (!Number.isInteger(seq) || seq <= 0 || serviceSocketLastSeq === null) {
+    return true;
+  }
+  if (serviceSocketResumeSeen) {
+    if (serviceSocketResumeSeen.has(seq)) {
+      return false;
+    }
+    serviceSocketResumeSeen.add(seq);
+  } else if (seq <= serviceSocketLastSeq) {
+    return false;
+  }
+  if (seq > serviceSocketLastSeq) {
+    saveServiceSocketLastSeq(seq);
+  }
+  return true;
+}
+
+// resumeServiceSocket asks for the events broadcast while this extension was
+// disconnected. A first connection has nothing to catch up on and starts
+// from the server's latest seq.
+async function resumeServiceSocket(socket) {
+  if (!serviceSocketHello || !serviceSocketHello.features || !serviceSocketHello.features.resume) {
+    return;
+  }
+  const latestSeq = Number.isInteger(serviceSocketHello.latest_seq) ? serviceSocketHello.latest_seq : 0;
+  const lastSeq = await loadServiceSocketLastSeq();
+  if (serviceSocket !== socket) {
+    return;
+  }
+  if (lastSeq < 0) {
+    saveServiceSocketLastSeq(latestSeq);
+    return;
+  }
+
+  serviceSocketResumeSeen = new Set();
+  try {
+    const data = await requestServiceSocket(SERVICE_WS_MESSAGE_TYPES.resume, { last_seq: lastSeq });
+    pushDebugLog("service.ws.resumed", { last_seq: lastSeq, replayed: data.replayed || 0 });
+  } catch (error) {
+    const data = error.data || {};
+    if (!data.resync) {
+      pushDebugLog("service.ws.resume_failed", { last_seq: lastSeq, error: stringifyError(error) });
+      return;
+    }
+    pushDebugLog("service.ws.resync", { last_seq: lastSeq, latest_seq: data.latest_seq });
+    saveServiceSocketLastSeq(Number.isInteger(data.latest_seq) ? data.latest_seq : 0);
+    notifyPopupDashboardUpdated("service.ws.resync", "");
+  } finally {
+    serviceSocketResumeSeen = null;
+  }
+}
+
+function rejectPendingServiceSocketRequests(reason) {
+  for (const [messageID, pending] of serviceSocketPendingRequests) {
+    serviceSocketPendingRequests.delete(messageID);
+    clearTimeout(pending.timer);
+    pending.reject(new Error(reason));
+  }
+}
+
+async function sendServiceSocketHello(socket) {
+  try {
+    const data = await requestServiceSocket(SERVICE_WS_MESSAGE_TYPES.hello, {
+      protocol_version: SERVICE_WS_PROTOCOL_VERSION,
+      extension_version: chrome.runtime.getManifest().version,
+      capabilities: SERVICE_WS_CAPABILITIES
+    });
+    if (serviceSocket !== socket) {
+      return;
+    }
+    serviceSocketHello = data;
+    pushDebugLog("service.ws.hello", {
+      protocol_version: data.protocol_version,
+      limits: data.limits || {},
+      features: data.features || {}
+    });
+  } catch (error) {
+    pushDebugLog("service.ws.hello_failed", { error: stringifyError(error) });
+    if (serviceSocket === socket) {
+      // Without a hello reply, commands go out one by one.
+      serviceSocketHello = {};
+      flushServiceSocketOutbox();
+    }
+    return;
+  }
+
+  await subscribeServiceSocketTopics(socket);
+  await resumeServiceSocket(socket);
+  flushServiceSocketOutbox();
+}
+
+async function subscribeServiceSocketTopics(socket) {
+  if (!serviceSocketHello || !serviceSocketHello.features || !serviceSocketHello.features.topics) {
+    return;
+  }
+  try {
+    const data = await requestServiceSocket(SERVICE_WS_MESSAGE_TYPES.subscribe, { topics: SERVICE_WS_TOPICS });
+    if (serviceSocket === socket) {
+      pushDebugLog("service.ws.subscribed", { topics: data.topics || [] });
+    }
+  } catch (error) {
+    pushDebugLog("service.ws.subscribe_failed", { error: stringifyError(error) });
+  }
+}
+
+// sendServiceCommand queues a command and resolves with the data of its ack.
+// A command that cannot be sent yet stays queued for the next connection;
+// the caller is told the service is connecting.
 async function sendServiceCommand(messageType, payload, errorPrefix) {
+  const entry = enqueueServiceSocketOutbox(messageType, payload);
   const ready = await waitForServiceSocketReady(messageType);
   if (!ready) {
-    pushDebugLog("service.ws.command_dropped_not_connected", {
+    pushDebugLog("service.ws.command_queued_not_connected", {
       type: messageType,
-      wait_ms: SERVICE_WS_CONNECT_WAIT_MS
+      wait_ms: SERVICE_WS_CONNECT_WAIT_MS,
+      queued: serviceSocketOutbox.length
     });
     throw new Error(SERVICE_CONNECTING_MESSAGE);
   }
 
   try {
-    queueServiceSocketMessage(messageType, payload);
+    return await Promise.race([
+      entry.acked,
+      sleep(SERVICE_WS_REQUEST_TIMEOUT_MS).then(() => {
+        throw new Error(SERVICE_CONNECTING_MESSAGE);
+      })
+    ]);
   } catch (error) {
     const message = stringifyError(error);
     if (message === SERVICE_OFFLINE_MESSAGE || message === SERVICE_CONNECTING_MESSAGE) {
@@ -1413,6 +1902,159 @@ async function sendServiceCommand(messageType, payload, errorPrefix) {
   }
 }
 
+function enqueueServiceSocketOutbox(messageType, payload) {
+  const entry = {
+    id: nextServiceSocketMessageID(),
+    type: messageType,
+    sent_at: nowIso(),
+    payload,
+    socket: null
+  };
+  entry.acked = new Promise((resolve, reject) => {
+    entry.resolve = resolve;
+    entry.reject = reject;
+  });
+  // Nobody awaits the ack of a command queued while offline.
+  entry.acked.catch(() => {});
+
+  serviceSocketOutbox.push(entry);
+  if (serviceSocketOutbox.length > SERVICE_WS_OUTBOX_LIMIT) {
+    const dropped = serviceSocketOutbox.shift();
+    dropped.reject(new Error("service outbox full"));
+    pushDebugLog("service.ws.outbox_dropped", { type: dropped.type, id: dropped.id });
+  }
+  scheduleServiceSocketOutboxFlush();
+  return entry;
+}
+
+function scheduleServiceSocketOutboxFlush() {
+  if (serviceSocketOutboxTimer) {
+    return;
+  }
+  serviceSocketOutboxTimer = setTimeout(() => {
+    serviceSocketOutboxTimer = null;
+    flushServiceSocketOutbox();
+  }, SERVICE_WS_OUTBOX_FLUSH_DELAY_MS);
+}
+
+function settleServiceSocketOutboxEntry(entry, ok, data, error) {
+  const index = serviceSocketOutbox.indexOf(entry);
+  if (index >= 0) {
+    serviceSocketOutbox.splice(index, 1);
+  }
+  if (ok) {
+    if (data && Array.isArray(data.rejected) && data.rejected.length) {
+      noteIngestRejections(entry.type, data.rejected);
+    }
+    entry.resolve(data || {});
+  } else {
+    entry.reject(new Error(error || "request failed"));
+  }
+}
+
+// The service skips list items that fail validation and names them in the
+// ack; keep a running count and the latest one for the popup diagnostics.
+function noteIngestRejections(messageType, rejected) {
+  const last = rejected[rejected.length - 1] || {};
+  const details = {
+    type: messageType,
+    id: last.id || "",
+    field: last.field || "",
+    reason: last.reason || ""
+  };
+  pushDebugLog("service.ingest.rejected", { ...details, count: rejected.length });
+  updateState((previous) => ({
+    ingest_rejected_count: (Number(previous.ingest_rejected_count) || 0) + rejected.length,
+    ingest_rejected_last: { ...details, at: nowIso() }
+  }));
+}
+
+// flushServiceSocketOutbox sends every queued command not yet sent on the
+// current socket, grouped into batch messages of at most max_batch items.
+// It waits for the hello reply, which carries the batch limits.
+function flushServiceSocketOutbox() {
+  if (!isServiceSocketReady() || !serviceSocketHello) {
+    return;
+  }
+  const socket = serviceSocket;
+  const unsent = serviceSocketOutbox.filter((entry) => entry.socket !== socket);
+  if (unsent.length === 0) {
+    return;
+  }
+
+  const limits = serviceSocketHello.limits || {};
+  const features = serviceSocketHello.features || {};
+  const maxBatch = features.batch && Number.isInteger(limits.max_batch) ? Math.max(1, limits.max_batch) : 1;
+  // Leave headroom under the read limit for the batch envelope.
+  const maxBytes = Number.isInteger(limits.read_limit_bytes) ? Math.floor(limits.read_limit_bytes * 0.9) : Infinity;
+
+  let chunk = [];
+  let chunkBytes = 0;
+  for (const entry of unsent) {
+    const entryBytes = JSON.stringify(entry.payload ?? null).length;
+    if (chunk.length > 0 && (chunk.length >= maxBatch || chunkBytes + entryBytes > maxBytes)) {
+      sendServiceSocketOutboxChunk(socket, chunk);
+      chunk = [];
+      chunkBytes = 0;
+    }
+    chunk.push(entry);
+    chunkBytes += entryBytes;
+  }
+  sendServiceSocketOutboxChunk(socket, chunk);
+}
+
+function sendServiceSocketOutboxChunk(socket, entries) {
+  if (entries.length === 0 || serviceSocket !== socket) {
+    return;
+  }
+  for (const entry of entries) {
+    entry.socket = socket;
+  }
+
+  let request;
+  if (entries.length === 1) {
+    const [entry] = entries;
+    request = requestServiceSocket(entry.type, entry.payload, entry.id).then(
+      (data) => settleServiceSocketOutboxEntry(entry, true, data),
+      (error) => settleServiceSocketOutboxEntryOnError(entry, socket, error)
+    );
+  } else {
+    const messages = entries.map((entry) => ({
+      id: entry.id,
+      type: entry.type,
+      sent_at: entry.sent_at,
+      payload: entry.payload
+    }));
+    request = requestServiceSocket(SERVICE_WS_MESSAGE_TYPES.batch, { messages }).then(
+      (data) => {
+        const results = Array.isArray(data.results) ? data.results : [];
+        entries.forEach((entry, index) => {
+          const result = results[index] || {};
+          settleServiceSocketOutboxEntry(entry, result.ok === true, result.data, result.error);
+        });
+      },
+      (error) => {
+        for (const entry of entries) {
+          settleServiceSocketOutboxEntryOnError(entry, socket, error);
+        }
+      }
+    );
+  }
+  request.catch(() => {
+    // Settled above.
+  });
+}
+
+// A command whose ack was lost with the connection is resent on the next
+// one; a command the server rejected is dropped.
+function settleServiceSocketOutboxEntryOnError(entry, socket, error) {
+  if (serviceSocket !== socket || !isServiceSocketReady()) {
+    entry.socket = null;
+    return;
+  }
+  settleServiceSocketOutboxEntry(entry, false, null, rawErrorMessage(error) || stringifyError(error));
+}
+
 function sendServiceCommandByName(commandName, payload) {
   const command = SERVICE_WS_COMMANDS[commandName];
   if (!command) {
@@ -1887,6 +2529,9 @@ const CAPTURED_JSON_RESPONSE_OPTIONS = Object.freeze({
       onParsed: (parsed, context) => {
         const event = priorityAdapters.toFullSnapshotEvent(parsed, context);
         if (event) { queuePrioritySnapshotEvent(event); }
+        if (context.details.tabId >= 0 && isFirstStudiesPage(context.normalizedURL)) {
+          return fetchRemainingStudiesPages(context.details.tabId, context.normalizedURL, parsed, "studies.response");
+        }
       },
       onSkip: (details) => {
         pushDebugLog("studies.response.capture.skip_non_collection", {
@@ -1952,6 +2597,20 @@ const CAPTURED_JSON_RESPONSE_OPTIONS = Object.freeze({
     commandName: "participantSubmissionsResponse",
     counterPrefix: "participant_submissions_response",
     eventPrefix: "participant.submissions.response"
+  }),
+  studyDetail: buildCapturedJSONResponseOptions({
+    normalizeURL: normalizeStudyDetailURL,
+    statusCode: 0,
+    commandName: "interceptedResponse",
+    counterPrefix: "study_detail_response",
+    eventPrefix: "study.detail.response"
+  }),
+  balance: buildCapturedJSONResponseOptions({
+    normalizeURL: normalizeUserBalanceURL,
+    statusCode: 0,
+    commandName: "interceptedResponse",
+    counterPrefix: "balance_response",
+    eventPrefix: "balance.response"
   })
 });
 
@@ -2205,6 +2864,12 @@ function registerStudiesResponseCaptureIfSupported() {
       }
       const normalizedURL = normalizeStudiesCollectionURL(details.url);
       if (!normalizedURL) {
+        const detailURL = normalizeStudyDetailURL(details.url);
+        if (detailURL) {
+          bumpCounter("study_detail_response_before_request_count", 1);
+          tapCapturedJSONResponse(details, CAPTURED_JSON_RESPONSE_OPTIONS.studyDetail, detailURL);
+          return;
+        }
         pushDebugLog("studies.response.capture.before_request.skip_non_collection", {
           url: details.url,
           request_id: details.requestId
@@ -2274,6 +2939,24 @@ function registerParticipantSubmissionsResponseCaptureIfSupported() {
   });
 }
 
+function registerBalanceResponseCaptureIfSupported() {
+  registerJSONBodyResponseCapture({
+    isRegistered: () => balanceResponseCaptureRegistered,
+    markRegistered: () => {
+      balanceResponseCaptureRegistered = true;
+    },
+    urls: [USER_BALANCE_PATTERN],
+    normalizeURL: normalizeUserBalanceURL,
+    beforeRequestCounter: "balance_response_before_request_count",
+    captureOptions: CAPTURED_JSON_RESPONSE_OPTIONS.balance,
+    unsupportedEvent: "balance.response.capture.unsupported",
+    unavailableEvent: "balance.response.capture.listener.unavailable",
+    registeredEvent: "balance.response.capture.registered",
+    registeredDetails: { patterns: [USER_BALANCE_PATTERN] },
+    registerErrorEvent: "balance.response.capture.register_error"
+  });
+}
+
 function registerOAuthCompletedFallbackListener() {
   if (oauthCompletedListenerRegistered) {
     return;
@@ -2337,6 +3020,7 @@ function registerCaptureListeners() {
   registerStudiesResponseCaptureIfSupported();
   registerSubmissionResponseCaptureIfSupported();
   registerParticipantSubmissionsResponseCaptureIfSupported();
+  registerBalanceResponseCaptureIfSupported();
   registerOAuthCompletedFallbackListener();
   registerOAuthResponseCaptureIfSupported();
 }
@@ -2461,7 +3145,8 @@ chrome.runtime.onMessage.addListener((message, sender, sendResponse) => {
       PRIORITY_FILTER_IGNORE_KEYWORDS_KEY,
       STUDIES_REFRESH_MIN_DELAY_SECONDS_KEY,
       STUDIES_REFRESH_AVERAGE_DELAY_SECONDS_KEY,
-      STUDIES_REFRESH_SPREAD_SECONDS_KEY
+      STUDIES_REFRESH_SPREAD_SECONDS_KEY,
+      SERVICE_AUTH_TOKEN_KEY
     ], (data) => {
       const refreshPolicy = normalizeStudiesRefreshPolicy(
         data[STUDIES_REFRESH_MIN_DELAY_SECONDS_KEY],
@@ -2482,14 +3167,13 @@ chrome.runtime.onMessage.addListener((message, sender, sendResponse) => {
         data[PRIORITY_FILTER_ALWAYS_OPEN_KEYWORDS_KEY],
         data[PRIORITY_FILTER_IGNORE_KEYWORDS_KEY]
       );
-      sendResponse({
-        ok: true,
-        settings: buildRefreshSettingsResponse(
-          refreshPolicy,
-          data[AUTO_OPEN_PROLIFIC_TAB_KEY] !== false,
-          priorityFilter
-        )
-      });
+      const settings = buildRefreshSettingsResponse(
+        refreshPolicy,
+        data[AUTO_OPEN_PROLIFIC_TAB_KEY] !== false,
+        priorityFilter
+      );
+      settings.service_paired = Boolean(data[SERVICE_AUTH_TOKEN_KEY]);
+      sendResponse({ ok: true, settings });
     });
     return true;
   }
@@ -2514,6 +3198,17 @@ chrome.runtime.onMessage.addListener((message, sender, sendResponse) => {
     });
   }
 
+  if (message && message.action === "pairService") {
+    return runMessageTask(sendResponse, async () => {
+      const code = String(message.code || "").trim();
+      if (!code) {
+        throw new Error("Enter the pairing code shown by the server.");
+      }
+      await pairWithService(code);
+      sendResponse({ ok: true, service_paired: true });
+    });
+  }
+
   if (message && message.action === "setAutoOpen") {
     return runMessageTask(sendResponse, async () => {
       const enabled = Boolean(message.enabled);
@@ -1,4 +1,7 @@
 const autoOpenToggle = document.getElementById("autoOpenToggle");
+const servicePairingStatusEl = document.getElementById("servicePairingStatus");
+const servicePairingCodeInput = document.getElementById("servicePairingCodeInput");
+const servicePairButton = document.getElementById("servicePairButton");
 const priorityFilterEnabledToggle = document.getElementById("priorityFilterEnabledToggle");
 const priorityAutoOpenInNewTabToggle = document.getElementById("priorityAutoOpenInNewTabToggle");
 const priorityAlertSoundToggle = document.getElementById("priorityAlertSoundToggle");
@@ -46,6 +49,9 @@ const AUTH_REQUIRED_MESSAGE = "Signed out of Prolific. Log in at app.prolific.co
 const AUTH_REQUIRED_PANEL_MESSAGE = "Waiting for login.";
 const RETRY_INTERVAL_MS = 5000;
 const DEFAULT_REFRESH_INTERVAL_MS = 60000;
+// While the background socket is connected, studies and submission changes
+// arrive as dashboardUpdated pushes and polling is only a safety net.
+const PUSH_FALLBACK_REFRESH_INTERVAL_MS = 300000;
 const REACTIVE_REFRESH_DEBOUNCE_MS = 150;
 const PRIORITY_FILTER_PERSIST_DEBOUNCE_MS = 250;
 const REFRESH_CYCLE_SECONDS = 120;
@@ -98,6 +104,7 @@ const DEBUG_EVENT_LABELS = Object.freeze({
   "studies.response.parse.error": "Response parse failed",
   "studies.response.filter.error": "Response capture failed",
   "studies.response.capture.on_parsed_error": "Response parse hook failed",
+  "service.ingest.rejected": "Items rejected by service",
   "settings.auto_open.updated": "Auto-open updated",
   "settings.priority_filter.updated": "Priority filter saved",
   "priority.alert.disabled": "Priority alert disabled",
@@ -117,7 +124,9 @@ const DEBUG_ROWS = Object.freeze([
   ["Last Refresh", (_, refresh) => formatDebugTime(refresh.last_studies_refresh_at)],
   ["Refresh Source", (_, refresh) => refresh.last_studies_refresh_source || "n/a"],
   ["Cadence", (state) => formatCadenceSummary(state)],
+  ["Refresh Role", (state) => state.service_refresh_role || "independent"],
   ["Last Issue", (state) => formatDebugIssue(state)],
+  ["Rejected Items", (state) => formatIngestRejections(state)],
   ["Log Entries", (state) => Number(state.debug_log_count_total) || 0]
 ]);
 let isRefreshingView = false;
@@ -206,8 +215,8 @@ function scheduleViewRefreshAfter(delayMs) {
   }, delayMs);
 }
 
-function scheduleRegularRefresh() {
-  scheduleViewRefreshAfter(DEFAULT_REFRESH_INTERVAL_MS);
+function scheduleRegularRefresh(pushConnected) {
+  scheduleViewRefreshAfter(pushConnected ? PUSH_FALLBACK_REFRESH_INTERVAL_MS : DEFAULT_REFRESH_INTERVAL_MS);
 }
 
 function applyObservedAtUpdate(observedAt) {
@@ -830,6 +839,16 @@ async function getSettings() {
   return response.settings || {};
 }
 
+async function pairService(code) {
+  await sendRuntimeMessage("pairService", { code });
+}
+
+function renderServicePairing(paired) {
+  servicePairingStatusEl.textContent = paired
+    ? "Paired. Pair again only if the token was revoked."
+    : "Enter the pairing code the Go server logs at startup (or run: go run . token pair).";
+}
+
 async function setAutoOpen(enabled) {
   await sendRuntimeMessage("setAutoOpen", { enabled });
 }
@@ -1369,6 +1388,16 @@ function formatDebugTime(value) {
   return formatRelative(value);
 }
 
+function formatIngestRejections(state) {
+  const count = Number(state && state.ingest_rejected_count) || 0;
+  const last = state && state.ingest_rejected_last;
+  if (!count || !last) {
+    return "none";
+  }
+  const field = last.field ? `${last.field}: ` : "";
+  return `${count} (last ${formatDebugTime(last.at)}, ${compactText(field + last.reason)})`;
+}
+
 function formatAuthStatus(state) {
   if (!state || typeof state !== "object") {
     return "n/a";
@@ -1499,6 +1528,7 @@ async function refreshSettings() {
   try {
     const settings = await getSettings();
     autoOpenToggle.checked = settings.auto_open_prolific_tab !== false;
+    renderServicePairing(settings.service_paired === true);
     const priorityFilter = normalizePriorityFilterFromSettings(settings);
     applyPriorityFilterToControls(priorityFilter);
     const refreshPolicy = normalizeRefreshPolicy(
@@ -1574,7 +1604,7 @@ async function refreshView() {
       startOfflineRetryLoop();
     } else {
       stopRetryCountdown();
-      scheduleRegularRefresh();
+      scheduleRegularRefresh(Boolean(extensionState && extensionState.service_ws_connected));
 
       if (authRequired) {
         renderAuthRequiredPanels();
@@ -1788,6 +1818,17 @@ function applyRefreshPolicyToControls(refreshPolicy) {
   updateRefreshCadenceActions();
 }
 
+servicePairButton.addEventListener("click", async () => {
+  try {
+    await pairService(servicePairingCodeInput.value);
+    servicePairingCodeInput.value = "";
+    await refreshSettings();
+    await refreshView();
+  } catch (error) {
+    setHealthError(error.message);
+  }
+});
+
 autoOpenToggle.addEventListener("change", async (event) => {
   try {
     await setAutoOpen(Boolean(event.target.checked));
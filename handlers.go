@@ -2,8 +2,6 @@ package main
 
 import (
 	"encoding/json"
-	"errors"
-	"fmt"
 	"net/http"
 	"net/url"
 	"slices"
@@ -22,13 +20,21 @@ func (s *Service) handleHealthz(w http.ResponseWriter, _ *http.Request) {
 }
 
 func (s *Service) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	status, err := s.queryStatus()
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Service) queryStatus() (map[string]any, error) {
 	status := map[string]any{}
 
 	if s.stateStore != nil {
 		refreshState, err := s.stateStore.GetStudiesRefresh()
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "failed to load studies refresh state", nil)
-			return
+			return nil, internalServerError("failed to load studies refresh state")
 		}
 		if refreshState != nil && !refreshState.LastStudiesRefreshAt.IsZero() {
 			status["last_studies_refresh_at"] = refreshState.LastStudiesRefreshAt
@@ -38,71 +44,137 @@ func (s *Service) handleStatus(w http.ResponseWriter, _ *http.Request) {
 		}
 	}
 
-	writeJSON(w, http.StatusOK, status)
+	status["studies_quarantine"] = s.studiesQuarantine.snapshot(s.config.MassDrop)
+	status["studies_pagination"] = s.studiesPagination.snapshot()
+	status["extension"] = s.wsStatus()
+	status["dedupe"] = s.dedupe.status()
+	status["refresh_leader"] = s.refreshLeaderStatus()
+	return status, nil
 }
 
 func (s *Service) handleStudyEvents(w http.ResponseWriter, r *http.Request) {
-	limit, err := parseIntQuery(r, "limit", defaultRecentEventsLimit, 1, maxRecentEventsLimit)
+	result, err := s.queryStudyEvents(r.URL.Query())
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error(), nil)
+		writeAPIError(w, err)
 		return
 	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Service) queryStudyEvents(query url.Values) (map[string]any, error) {
+	limit, err := parseIntValue(query, "limit", defaultRecentEventsLimit, 1, maxRecentEventsLimit)
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
 
 	events, err := s.studiesStore.GetRecentAvailabilityEvents(limit)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to load study events", nil)
-		return
+		return nil, internalServerError("failed to load study events")
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{
+	return map[string]any{
 		"events": events,
 		"meta": map[string]any{
 			"count": len(events),
 		},
-	})
+	}, nil
 }
 
-func normalizeSubmissionPhaseQueryOrBadRequest(w http.ResponseWriter, raw string) (string, bool) {
+func normalizeSubmissionPhaseQuery(raw string) (string, error) {
 	phase := strings.ToLower(strings.TrimSpace(raw))
 	if phase == "" || phase == "all" {
-		return "all", true
+		return "all", nil
 	}
 
 	if phase == SubmissionPhaseSubmitting || phase == SubmissionPhaseSubmitted {
-		return phase, true
+		return phase, nil
 	}
 
-	writeError(w, http.StatusBadRequest, "phase must be one of: all, submitting, submitted", nil)
-	return "", false
+	return "", badRequest("phase must be one of: all, submitting, submitted")
 }
 
 func (s *Service) handleSubmissions(w http.ResponseWriter, r *http.Request) {
+	result, err := s.querySubmissions(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Service) querySubmissions(query url.Values) (map[string]any, error) {
 	if s.submissionsStore == nil {
-		writeError(w, http.StatusServiceUnavailable, "submissions store not configured", nil)
+		return nil, serviceUnavailable("submissions store not configured")
+	}
+
+	phase, err := normalizeSubmissionPhaseQuery(query.Get("phase"))
+	if err != nil {
+		return nil, err
+	}
+	limit, err := parseIntValue(query, "limit", defaultCurrentSubmissions, 1, maxCurrentSubmissions)
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
+
+	submissions, err := s.submissionsStore.GetCurrentSubmissions(limit, phase)
+	if err != nil {
+		logWarn("submissions.load_failed", "error", err)
+		return nil, internalServerError("failed to load submissions")
+	}
+
+	return map[string]any{
+		"results": submissions,
+		"meta": map[string]any{
+			"count": len(submissions),
+			"phase": phase,
+		},
+	}, nil
+}
+
+func (s *Service) handleBalance(w http.ResponseWriter, _ *http.Request) {
+	if s.balancesStore == nil {
+		writeError(w, http.StatusServiceUnavailable, "balances store not configured", nil)
 		return
 	}
 
-	phase, ok := normalizeSubmissionPhaseQueryOrBadRequest(w, r.URL.Query().Get("phase"))
-	if !ok {
+	balance, err := s.balancesStore.GetLatest()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load balance", nil)
+		return
+	}
+	if balance == nil {
+		writeJSON(w, http.StatusOK, map[string]any{"has_balance": false})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"has_balance": true,
+		"balance":     balance,
+	})
+}
+
+func (s *Service) handleBalanceHistory(w http.ResponseWriter, r *http.Request) {
+	if s.balancesStore == nil {
+		writeError(w, http.StatusServiceUnavailable, "balances store not configured", nil)
 		return
 	}
-	limit, err := parseIntQuery(r, "limit", defaultCurrentSubmissions, 1, maxCurrentSubmissions)
+
+	limit, err := parseIntQuery(r, "limit", defaultBalanceHistoryLimit, 1, maxBalanceHistoryLimit)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err.Error(), nil)
 		return
 	}
 
-	submissions, err := s.submissionsStore.GetCurrentSubmissions(limit, phase)
+	history, err := s.balancesStore.GetHistory(limit)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to load submissions", err)
+		writeError(w, http.StatusInternalServerError, "failed to load balance history", nil)
 		return
 	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
-		"results": submissions,
+		"results": history,
 		"meta": map[string]any{
-			"count": len(submissions),
-			"phase": phase,
+			"count": len(history),
 		},
 	})
 }
@@ -140,55 +212,6 @@ type interceptedResponsePayload struct {
 	Body       json.RawMessage `json:"body"`
 }
 
-func normalizeSubmissionURL(raw string) (string, bool) {
-	parsed, err := url.Parse(strings.TrimSpace(raw))
-	if err != nil || parsed == nil {
-		return "", false
-	}
-	if parsed.Scheme != "https" || strings.ToLower(strings.TrimSpace(parsed.Hostname())) != internalStudiesHost {
-		return "", false
-	}
-
-	path := parsed.Path
-	if path == "/api/v1/submissions/reserve/" {
-		parsed.Path = "/api/v1/submissions/reserve/"
-		parsed.RawQuery = ""
-		return parsed.String(), true
-	}
-
-	parts := strings.Split(strings.Trim(path, "/"), "/")
-	if len(parts) == 5 &&
-		parts[0] == "api" &&
-		parts[1] == "v1" &&
-		parts[2] == "submissions" &&
-		parts[3] != "" &&
-		parts[4] == "transition" {
-		parsed.Path = "/api/v1/submissions/" + parts[3] + "/transition/"
-		parsed.RawQuery = ""
-		return parsed.String(), true
-	}
-
-	return "", false
-}
-
-func normalizeParticipantSubmissionsURL(raw string) (string, bool) {
-	parsed, err := url.Parse(strings.TrimSpace(raw))
-	if err != nil || parsed == nil {
-		return "", false
-	}
-	if parsed.Scheme != "https" || strings.ToLower(strings.TrimSpace(parsed.Hostname())) != internalStudiesHost {
-		return "", false
-	}
-
-	path := strings.TrimSpace(parsed.Path)
-	if path != internalParticipantSubmissionsPath && path != strings.TrimSuffix(internalParticipantSubmissionsPath, "/") {
-		return "", false
-	}
-
-	parsed.Path = internalParticipantSubmissionsPath
-	return parsed.String(), true
-}
-
 type submissionStudyPayload struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
@@ -276,12 +299,12 @@ func buildSubmissionSnapshot(
 ) (*SubmissionSnapshot, error) {
 	submissionID = strings.TrimSpace(submissionID)
 	if submissionID == "" {
-		return nil, errors.New("submission response missing id")
+		return nil, invalidField("id", "required")
 	}
 
 	status = strings.ToUpper(strings.TrimSpace(status))
 	if status == "" {
-		return nil, errors.New("submission response missing status")
+		return nil, invalidField("status", "required")
 	}
 
 	participantID = strings.TrimSpace(participantID)
@@ -310,7 +333,7 @@ func buildSubmissionSnapshot(
 
 func normalizeSubmissionSnapshot(body []byte) (*SubmissionSnapshot, error) {
 	var parsed submissionResponseBody
-	if err := json.Unmarshal(body, &parsed); err != nil {
+	if err := decodeItem(body, &parsed); err != nil {
 		return nil, err
 	}
 
@@ -339,8 +362,8 @@ func normalizeSubmissionSnapshot(body []byte) (*SubmissionSnapshot, error) {
 
 func normalizeSubmissionSnapshotFromParticipantListItem(itemPayload json.RawMessage) (*SubmissionSnapshot, error) {
 	var item participantSubmissionListItem
-	if err := json.Unmarshal(itemPayload, &item); err != nil {
-		return nil, fmt.Errorf("unmarshal participant submission item: %w", err)
+	if err := decodeItem(itemPayload, &item); err != nil {
+		return nil, err
 	}
 
 	participantID := strings.TrimSpace(item.ParticipantID)
@@ -371,58 +394,26 @@ func normalizeSubmissionSnapshotFromParticipantListItem(itemPayload json.RawMess
 	return snapshot, nil
 }
 
-func (s *Service) ingestSubmissionPayload(
-	body []byte,
-	observedAt time.Time,
-) (*SubmissionUpdateResult, error) {
-	if s.submissionsStore == nil {
-		return nil, errors.New("submissions store is not configured")
-	}
-
-	snapshot, err := normalizeSubmissionSnapshot(body)
-	if err != nil {
-		return nil, err
-	}
-
-	update, err := s.submissionsStore.UpsertSnapshot(*snapshot, observedAt)
-	if err != nil {
-		return nil, err
-	}
-
-	return update, nil
-}
-
-func (s *Service) ingestParticipantSubmissionsPayload(
-	body []byte,
-	observedAt time.Time,
-) (int, int, error) {
-	if s.submissionsStore == nil {
-		return 0, 0, errors.New("submissions store is not configured")
-	}
-
+// decodeParticipantSubmissions normalizes a participant submissions list.
+// Items that fail validation are reported as rejected and skipped.
+func decodeParticipantSubmissions(body []byte) ([]SubmissionSnapshot, int, []rejectedItem, error) {
 	var parsed participantSubmissionsListResponse
 	if err := json.Unmarshal(body, &parsed); err != nil {
-		return 0, 0, err
+		return nil, 0, nil, err
 	}
 
-	total := len(parsed.Results)
-	upserted := 0
-	baseObservedAt := utcNowOr(observedAt)
-
-	for _, itemPayload := range parsed.Results {
+	snapshots := make([]SubmissionSnapshot, 0, len(parsed.Results))
+	rejected := make([]rejectedItem, 0)
+	for index, itemPayload := range parsed.Results {
 		snapshot, err := normalizeSubmissionSnapshotFromParticipantListItem(itemPayload)
 		if err != nil {
-			logWarn("participant.submissions.item_parse_failed", "error", err)
+			rejected = append(rejected, rejectItem(index, itemID(itemPayload), err))
 			continue
 		}
-
-		if _, err := s.submissionsStore.UpsertSnapshot(*snapshot, baseObservedAt); err != nil {
-			return total, upserted, err
-		}
-		upserted++
+		snapshots = append(snapshots, *snapshot)
 	}
 
-	return total, upserted, nil
+	return snapshots, len(parsed.Results), rejected, nil
 }
 
 func (s *Service) markStudiesRefresh(update StudiesRefreshUpdate) error {
@@ -447,7 +438,7 @@ func (s *Service) ingestStudiesPayload(
 	source string,
 	sourceURL string,
 	statusCode int,
-) (*normalizedStudiesResponse, *StudyAvailabilitySummary, error) {
+) (*normalizedStudiesResponse, *StudyAvailabilitySummary, *studiesPageProgress, error) {
 	observedAt = utcNowOr(observedAt)
 	if statusCode == 0 {
 		statusCode = http.StatusOK
@@ -463,13 +454,51 @@ func (s *Service) ingestStudiesPayload(
 		}); err != nil {
 			logWarn("studies.refresh.persist_state_failed", "error", err)
 		}
-		return nil, nil, err
+		return nil, nil, nil, err
+	}
+	// Invalid results may still be listed, so their absence proves nothing.
+	// A repeated ID is already covered by its first occurrence.
+	incomplete := normalizedBody.Invalid > 0
+
+	page := parseStudiesPage(sourceURL, normalizedBody.Links)
+	if !page.paginated {
+		availability := s.reconcileStudies(normalizedBody.Results, observedAt, source, sourceURL, statusCode, incomplete)
+		return normalizedBody, availability, nil, nil
 	}
-	if err := s.studiesStore.StoreNormalizedStudies(normalizedBody.Results, observedAt); err != nil {
-		logWarn("studies.persist_failed", "error", err)
+
+	session, progress := s.collectStudiesPage(page, normalizedBody.Results, observedAt, source, sourceURL, incomplete)
+	logInfo("studies.pagination.page", "url", page.key, "page", progress.Page, "last_page", progress.LastPage, "pages_collected", progress.PagesCollected)
+	if session == nil {
+		if err := s.markStudiesRefresh(StudiesRefreshUpdate{
+			ObservedAt: observedAt,
+			Source:     source,
+			URL:        sourceURL,
+			StatusCode: statusCode,
+		}); err != nil {
+			logWarn("studies.refresh.persist_state_failed", "error", err)
+		}
+		return normalizedBody, nil, &progress, nil
 	}
+	availability := s.reconcileStudies(session.studies(), observedAt, source, sourceURL, statusCode, session.incomplete)
+	return normalizedBody, availability, &progress, nil
+}
 
-	availability, err := s.studiesStore.ReconcileAvailability(normalizedBody.Results, observedAt)
+// reconcileStudies diffs a full (or, with partial set, incomplete) listing
+// against the active snapshot, logs the resulting study events and records
+// the refresh. Full listings caught by the mass-drop guard are applied as
+// partial ones.
+func (s *Service) reconcileStudies(
+	studies []normalizedStudy,
+	observedAt time.Time,
+	source string,
+	sourceURL string,
+	statusCode int,
+	partial bool,
+) *StudyAvailabilitySummary {
+	guard := func(active map[string]string) bool {
+		return s.guardStudiesRefresh(active, studies, observedAt, source, sourceURL, statusCode)
+	}
+	availability, err := s.studiesStore.RecordListing(studies, observedAt, partial, guard)
 	if err != nil {
 		logWarn("studies.reconcile_failed", "error", err)
 	}
@@ -478,9 +507,21 @@ func (s *Service) ingestStudiesPayload(
 		for _, change := range availability.NewlyAvailable {
 			logInfo("study_event", "event_type", "available", "study_id", change.StudyID, "name", change.Name, "observed_at", availability.ObservedAt)
 		}
+		for i := range availability.Reopened {
+			reopen := &availability.Reopened[i]
+			reopen.Flicker = time.Duration(reopen.GapSeconds)*time.Second < s.config.ReopenFlickerWindow
+			logInfo("study_event", "event_type", "reopened", "study_id", reopen.StudyID, "name", reopen.Name, "gap_seconds", reopen.GapSeconds, "reopen_count", reopen.ReopenCount, "flicker", reopen.Flicker, "observed_at", availability.ObservedAt)
+		}
 		for _, change := range availability.BecameUnavailable {
 			logInfo("study_event", "event_type", "unavailable", "study_id", change.StudyID, "name", change.Name, "observed_at", availability.ObservedAt)
 		}
+		for _, update := range availability.Updated {
+			fields := make([]string, 0, len(update.Changes))
+			for _, change := range update.Changes {
+				fields = append(fields, change.Field)
+			}
+			logInfo("study_event", "event_type", "updated", "study_id", update.StudyID, "name", update.Name, "fields", strings.Join(fields, ","), "reward_increase", update.RewardIncrease, "observed_at", availability.ObservedAt)
+		}
 	}
 
 	refreshUpdate := StudiesRefreshUpdate{
@@ -490,13 +531,23 @@ func (s *Service) ingestStudiesPayload(
 		StatusCode: statusCode,
 	}
 	if availability != nil {
+		refreshUpdate.Quarantined = availability.Quarantined
 		newlyAvailableIDs := make(map[string]struct{}, len(availability.NewlyAvailable))
 		for _, change := range availability.NewlyAvailable {
 			newlyAvailableIDs[change.StudyID] = struct{}{}
 		}
+		// Reopens are announced like new studies unless they are flickers,
+		// which the extension has already alerted on before they blinked out.
+		reopenedByID := make(map[string]StudyReopen, len(availability.Reopened))
+		for _, reopen := range availability.Reopened {
+			reopenedByID[reopen.StudyID] = reopen
+			if !reopen.Flicker {
+				newlyAvailableIDs[reopen.StudyID] = struct{}{}
+			}
+		}
 
 		newlyAvailableStudies := make([]normalizedStudy, 0, len(newlyAvailableIDs))
-		for _, study := range normalizedBody.Results {
+		for _, study := range studies {
 			if _, ok := newlyAvailableIDs[study.ID]; !ok {
 				continue
 			}
@@ -504,6 +555,22 @@ func (s *Service) ingestStudiesPayload(
 		}
 		refreshUpdate.NewlyAvailableStudies = newlyAvailableStudies
 
+		reopenedStudies := make([]ReopenedStudy, 0, len(reopenedByID))
+		for _, study := range studies {
+			reopen, ok := reopenedByID[study.ID]
+			if !ok {
+				continue
+			}
+			study.ReopenCount = reopen.ReopenCount
+			reopenedStudies = append(reopenedStudies, ReopenedStudy{
+				Study:       study,
+				GapSeconds:  reopen.GapSeconds,
+				ReopenCount: reopen.ReopenCount,
+				Flicker:     reopen.Flicker,
+			})
+		}
+		refreshUpdate.ReopenedStudies = reopenedStudies
+
 		becameUnavailableStudyIDs := make([]string, 0, len(availability.BecameUnavailable))
 		for _, change := range availability.BecameUnavailable {
 			if strings.TrimSpace(change.StudyID) == "" {
@@ -512,12 +579,34 @@ func (s *Service) ingestStudiesPayload(
 			becameUnavailableStudyIDs = append(becameUnavailableStudyIDs, change.StudyID)
 		}
 		refreshUpdate.BecameUnavailableStudyIDs = becameUnavailableStudyIDs
+
+		updatedByID := make(map[string]StudyUpdate, len(availability.Updated))
+		for _, update := range availability.Updated {
+			updatedByID[update.StudyID] = update
+		}
+		updatedStudies := make([]UpdatedStudy, 0, len(updatedByID))
+		for _, study := range studies {
+			update, ok := updatedByID[study.ID]
+			if !ok {
+				continue
+			}
+			updatedStudies = append(updatedStudies, UpdatedStudy{
+				Study:          study,
+				Changes:        update.Changes,
+				RewardIncrease: update.RewardIncrease,
+			})
+		}
+		refreshUpdate.UpdatedStudies = updatedStudies
 	}
 	if err := s.markStudiesRefresh(refreshUpdate); err != nil {
 		logWarn("studies.refresh.persist_state_failed", "error", err)
 	}
+	if availability != nil {
+		s.broadcastAvailabilityEvent(*availability)
+		s.broadcastPriorityMatches(refreshUpdate.NewlyAvailableStudies, observedAt)
+	}
 
-	return normalizedBody, availability, nil
+	return availability
 }
 
 func (s *Service) handleDebugExtensionState(w http.ResponseWriter, _ *http.Request) {
@@ -539,23 +628,172 @@ func (s *Service) handleDebugExtensionState(w http.ResponseWriter, _ *http.Reque
 }
 
 func (s *Service) handleStudies(w http.ResponseWriter, r *http.Request) {
-	limit, err := parseIntQuery(r, "limit", defaultCurrentStudies, 1, maxCurrentStudies)
+	result, err := s.queryStudies(r.URL.Query())
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error(), nil)
+		writeAPIError(w, err)
 		return
 	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Service) queryStudies(query url.Values) (map[string]any, error) {
+	limit, err := parseIntValue(query, "limit", defaultCurrentStudies, 1, maxCurrentStudies)
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
 
 	studies, err := s.studiesStore.GetCurrentAvailableStudies(limit)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to load current studies", nil)
-		return
+		return nil, internalServerError("failed to load current studies")
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{
+	return map[string]any{
 		"results": studies,
 		"meta": map[string]any{
 			"count":  len(studies),
 			"source": "cache",
 		},
+	}, nil
+}
+
+func (s *Service) handleAnalyticsEffectiveRate(w http.ResponseWriter, r *http.Request) {
+	if s.analyticsStore == nil {
+		writeError(w, http.StatusServiceUnavailable, "analytics store not configured", nil)
+		return
+	}
+
+	limit, err := parseIntQuery(r, "limit", defaultEffectiveRateLimit, 1, maxEffectiveRateLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	report, err := s.analyticsStore.GetEffectiveRates(limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load effective rate analytics", nil)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"submissions":   report.Submissions,
+		"by_researcher": report.ByResearcher,
+		"by_study_type": report.ByStudyType,
+		"meta": map[string]any{
+			"count": len(report.Submissions),
+		},
+	})
+}
+
+func (s *Service) handleAnalyticsMissed(w http.ResponseWriter, r *http.Request) {
+	if s.analyticsStore == nil {
+		writeError(w, http.StatusServiceUnavailable, "analytics store not configured", nil)
+		return
+	}
+
+	days, err := parseIntQuery(r, "days", defaultMissedDays, 1, maxMissedDays)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	minHourly, err := parseFloatQuery(r, "min_hourly", s.config.MissedMinHourlyRewardMajor)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	minReward, err := parseFloatQuery(r, "min_reward", s.config.MissedMinRewardMajor)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	gapSeconds, err := parseIntQuery(r, "refresh_gap_seconds", int(s.config.MissedRefreshGap/time.Second), 1, 86400)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	query := MissedOpportunityQuery{
+		Since:                time.Now().UTC().AddDate(0, 0, -days),
+		MinHourlyRewardMajor: minHourly,
+		MinRewardMajor:       minReward,
+		RefreshGap:           time.Duration(gapSeconds) * time.Second,
+	}
+	missed, err := s.analyticsStore.GetMissedOpportunities(query)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load missed opportunities", nil)
+		return
+	}
+
+	explained := 0
+	for _, item := range missed {
+		if item.ExplainedByRefreshGap {
+			explained++
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"results": missed,
+		"meta": map[string]any{
+			"count":                    len(missed),
+			"explained_by_refresh_gap": explained,
+			"since":                    query.Since,
+			"min_hourly":               minHourly,
+			"min_reward":               minReward,
+			"refresh_gap_seconds":      gapSeconds,
+		},
 	})
 }
+
+func (s *Service) handleDailyReport(w http.ResponseWriter, r *http.Request) {
+	if s.analyticsStore == nil {
+		writeError(w, http.StatusServiceUnavailable, "analytics store not configured", nil)
+		return
+	}
+
+	format, ok := normalizeReportFormat(r.URL.Query().Get("format"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, "format must be one of: markdown, html", nil)
+		return
+	}
+	day, err := parseReportDate(r.URL.Query().Get("date"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	report, err := s.analyticsStore.BuildDailyReport(day, s.config.PriorityFilter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to build daily report", nil)
+		return
+	}
+	rendered, err := renderDailyReport(report, format)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to render daily report", nil)
+		return
+	}
+
+	if format == reportFormatHTML {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	}
+	_, _ = w.Write([]byte(rendered))
+}
+
+func (s *Service) handleStudy(w http.ResponseWriter, r *http.Request) {
+	studyID := strings.TrimSpace(r.PathValue("id"))
+	if studyID == "" {
+		writeError(w, http.StatusBadRequest, "study id is required", nil)
+		return
+	}
+
+	study, err := s.studiesStore.GetStudy(studyID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load study", nil)
+		return
+	}
+	if study == nil {
+		writeError(w, http.StatusNotFound, "study not found", nil)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, study)
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 )
@@ -24,12 +27,27 @@ func writeError(w http.ResponseWriter, status int, message string, detail error)
 
 func setExtensionCORSHeaders(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Idempotency-Key")
+}
+
+// readRequestBody reads the body, capped at the WebSocket read limit, and
+// leaves a fresh copy on r so handlers can read it again.
+func readRequestBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, wsReadLimitBytes))
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
 }
 
 func parseIntQuery(r *http.Request, key string, fallback, min, max int) (int, error) {
-	raw := r.URL.Query().Get(key)
+	return parseIntValue(r.URL.Query(), key, fallback, min, max)
+}
+
+func parseIntValue(query url.Values, key string, fallback, min, max int) (int, error) {
+	raw := query.Get(key)
 	if raw == "" {
 		return fallback, nil
 	}
@@ -47,6 +65,19 @@ func parseIntQuery(r *http.Request, key string, fallback, min, max int) (int, er
 	return parsed, nil
 }
 
+func parseFloatQuery(r *http.Request, key string, fallback float64) (float64, error) {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number", key)
+	}
+	return parsed, nil
+}
+
 func utcNowOr(t time.Time) time.Time {
 	if t.IsZero() {
 		return time.Now().UTC()
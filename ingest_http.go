@@ -0,0 +1,43 @@
+package main
+
+import "net/http"
+
+// ingestHTTPRoutes maps each POST /ingest route to the WebSocket message type
+// whose processing it shares.
+var ingestHTTPRoutes = []struct {
+	path        string
+	messageType string
+}{
+	{"/ingest/studies-response", wsTypeStudiesResponse},
+	{"/ingest/submission-response", wsTypeSubmission},
+	{"/ingest/participant-submissions", wsTypeParticipantSubs},
+	{"/ingest/studies-refresh", wsTypeStudiesRefresh},
+	{"/ingest/intercepted-response", wsTypeInterceptedResponse},
+}
+
+func (s *Service) registerIngestRoutes(mux *http.ServeMux) {
+	for _, route := range ingestHTTPRoutes {
+		handler := s.handleIngest(route.messageType)
+		s.registerExtensionRoute(mux, route.path, http.MethodPost, s.withIdempotencyKey(handler))
+	}
+}
+
+// handleIngest accepts the same payload as the matching WebSocket message and
+// replies with what would have been the ack's data.
+func (s *Service) handleIngest(messageType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := readRequestBody(w, r)
+		if err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, "request body too large or unreadable", nil)
+			return
+		}
+
+		result, err := s.dispatchWSRequest(messageType, body)
+		if err != nil {
+			logWarn("ingest.http_failed", "type", messageType, "path", r.URL.Path, "error", err)
+			writeAPIError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
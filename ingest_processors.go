@@ -1,33 +1,16 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 )
 
-func normalizeURLOrAPIError(raw string, normalize func(string) (string, bool), message string) (string, error) {
-	normalizedURL, ok := normalize(raw)
-	if !ok {
-		return "", badRequest(message)
-	}
-	return normalizedURL, nil
-}
-
-func requireNonEmptyJSONBody(body []byte) error {
-	if len(body) > 0 {
-		return nil
-	}
-	return badRequest("body cannot be empty")
-}
-
 func (s *Service) processReceiveStudiesRefresh(payload StudiesRefreshUpdate) (map[string]any, error) {
 	if payload.URL != "" {
-		normalizedURL, err := normalizeURLOrAPIError(
-			payload.URL,
-			normalizeStudiesCollectionURL,
-			"url must target internal studies endpoint",
-		)
-		if err != nil {
-			return nil, err
+		normalizedURL, ok := normalizeStudiesCollectionURL(payload.URL)
+		if !ok {
+			return nil, badRequest("url must target internal studies endpoint")
 		}
 		payload.URL = normalizedURL
 	}
@@ -41,21 +24,11 @@ func (s *Service) processReceiveStudiesRefresh(payload StudiesRefreshUpdate) (ma
 	return map[string]any{"success": true}, nil
 }
 
-func (s *Service) processReceiveStudiesResponse(payload interceptedResponsePayload) (map[string]any, error) {
-	normalizedURL, err := normalizeURLOrAPIError(
-		payload.URL,
-		normalizeStudiesCollectionURL,
-		"url must target internal studies endpoint",
-	)
+func (s *Service) processReceiveStudiesResponse(payload interceptedResponse) (map[string]any, error) {
+	body, err := requireBody(payload)
 	if err != nil {
 		return nil, err
 	}
-	payload.URL = normalizedURL
-
-	if err := requireNonEmptyJSONBody(payload.Body); err != nil {
-		return nil, err
-	}
-
 	if payload.StatusCode != 0 && payload.StatusCode != http.StatusOK {
 		if err := s.markStudiesRefresh(StudiesRefreshUpdate{
 			ObservedAt: payload.ObservedAt,
@@ -68,7 +41,7 @@ func (s *Service) processReceiveStudiesResponse(payload interceptedResponsePaylo
 		return map[string]any{"success": true}, nil
 	}
 
-	normalized, availability, err := s.ingestStudiesPayload(payload.Body, payload.ObservedAt, "extension.intercepted_response", payload.URL, http.StatusOK)
+	normalized, availability, progress, err := s.ingestStudiesPayload(body, payload.ObservedAt, "extension.intercepted_response", payload.URL, http.StatusOK)
 	if err != nil {
 		logWarn("studies.response.ingest_failed", "source", "extension.intercepted_response", "url", payload.URL, "error", err)
 		return nil, badRequest("failed to ingest studies response")
@@ -78,95 +51,268 @@ func (s *Service) processReceiveStudiesResponse(payload interceptedResponsePaylo
 	if availability != nil {
 		response["changes"] = availability
 	}
+	if progress != nil {
+		response["pagination"] = progress
+	}
+	s.recordRejections(payload.Route, normalized.Rejected)
+	response["rejected"] = normalized.Rejected
 
 	logInfo("studies.response.ingested", "source", "extension.intercepted_response", "count", len(normalized.Results), "url", payload.URL)
 	return response, nil
 }
 
-func (s *Service) processReceiveSubmissionResponse(payload interceptedResponsePayload) (map[string]any, error) {
-	if s.submissionsStore == nil {
-		return nil, serviceUnavailable("submissions store not configured")
-	}
+// submissionIngest is a decoded submissions response whose writes can be
+// stored together with other ingests, such as its neighbours in a batch.
+type submissionIngest struct {
+	writes []SubmissionWrite
+	// announceNew also pushes submissions seen for the first time. Live
+	// reserve and transition responses set it; list syncs do not, or the
+	// first sync would announce every historical submission.
+	announceNew bool
+	// failure is the error reported when the writes cannot be stored.
+	failure string
+	ack     func(updates []*SubmissionUpdateResult) map[string]any
+}
 
-	normalizedURL, err := normalizeURLOrAPIError(
-		payload.URL,
-		normalizeSubmissionURL,
-		"url must target internal submissions endpoint",
-	)
+func (s *Service) processReceiveSubmissionResponse(payload interceptedResponse) (map[string]any, error) {
+	ingest, err := s.prepareSubmissionResponse(payload)
 	if err != nil {
 		return nil, err
 	}
-	payload.URL = normalizedURL
+	return s.applySubmissionIngest(ingest)
+}
 
-	if err := requireNonEmptyJSONBody(payload.Body); err != nil {
+func (s *Service) prepareSubmissionResponse(payload interceptedResponse) (*submissionIngest, error) {
+	body, err := requireBody(payload)
+	if err != nil {
 		return nil, err
 	}
+	if s.submissionsStore == nil {
+		return nil, serviceUnavailable("submissions store not configured")
+	}
 
-	observedAt := utcNowOr(payload.ObservedAt)
-	update, err := s.ingestSubmissionPayload(payload.Body, observedAt)
+	snapshot, err := normalizeSubmissionSnapshot(body)
 	if err != nil {
 		logWarn("submission.response.ingest_failed", "source", "extension.intercepted_submission_response", "url", payload.URL, "error", err)
+		var invalid *itemValidationError
+		if errors.As(err, &invalid) {
+			s.recordRejections(payload.Route, []rejectedItem{rejectItem(0, itemID(body), err)})
+			return nil, badRequest("invalid submission response: " + invalid.Error())
+		}
 		return nil, badRequest("failed to ingest submission response")
 	}
 
-	logInfo(
-		"submission.response.ingested",
-		"source", "extension.intercepted_submission_response",
-		"url", payload.URL,
-		"submission_id", update.SubmissionID,
-		"study_id", update.StudyID,
-		"status", update.Status,
-		"phase", update.Phase,
-	)
-	return map[string]any{
-		"success":    true,
-		"submission": update,
+	return &submissionIngest{
+		writes:      []SubmissionWrite{{Snapshot: *snapshot, ObservedAt: utcNowOr(payload.ObservedAt)}},
+		announceNew: true,
+		failure:     "failed to ingest submission response",
+		ack: func(updates []*SubmissionUpdateResult) map[string]any {
+			update := updates[0]
+			logInfo(
+				"submission.response.ingested",
+				"source", "extension.intercepted_submission_response",
+				"url", payload.URL,
+				"submission_id", update.SubmissionID,
+				"study_id", update.StudyID,
+				"status", update.Status,
+				"phase", update.Phase,
+			)
+			return map[string]any{
+				"success":    true,
+				"submission": update,
+			}
+		},
 	}, nil
 }
 
-func (s *Service) processReceiveParticipantSubmissionsResponse(payload interceptedResponsePayload) (map[string]any, error) {
-	if s.submissionsStore == nil {
-		return nil, serviceUnavailable("submissions store not configured")
-	}
-
-	normalizedURL, err := normalizeURLOrAPIError(
-		payload.URL,
-		normalizeParticipantSubmissionsURL,
-		"url must target participant submissions endpoint",
-	)
+func (s *Service) processReceiveParticipantSubmissionsResponse(payload interceptedResponse) (map[string]any, error) {
+	ingest, err := s.prepareParticipantSubmissions(payload)
 	if err != nil {
 		return nil, err
 	}
-	payload.URL = normalizedURL
+	return s.applySubmissionIngest(ingest)
+}
 
-	if err := requireNonEmptyJSONBody(payload.Body); err != nil {
+func (s *Service) prepareParticipantSubmissions(payload interceptedResponse) (*submissionIngest, error) {
+	body, err := requireBody(payload)
+	if err != nil {
 		return nil, err
 	}
+	if s.submissionsStore == nil {
+		return nil, serviceUnavailable("submissions store not configured")
+	}
+
 	if payload.StatusCode != 0 && payload.StatusCode != http.StatusOK {
-		return map[string]any{"success": true, "ignored": true, "status_code": payload.StatusCode}, nil
+		return &submissionIngest{ack: func([]*SubmissionUpdateResult) map[string]any {
+			return map[string]any{"success": true, "ignored": true, "status_code": payload.StatusCode}
+		}}, nil
 	}
 
-	total, upserted, err := s.ingestParticipantSubmissionsPayload(
-		payload.Body,
-		utcNowOr(payload.ObservedAt),
-	)
+	snapshots, total, rejected, err := decodeParticipantSubmissions(body)
 	if err != nil {
 		logWarn("participant.submissions.ingest_failed", "source", "extension.intercepted_participant_submissions_response", "url", payload.URL, "error", err)
 		return nil, badRequest("failed to ingest participant submissions response")
 	}
 
-	logInfo(
-		"participant.submissions.ingested",
-		"source", "extension.intercepted_participant_submissions_response",
-		"url", payload.URL,
-		"total", total,
-		"upserted", upserted,
-	)
-	return map[string]any{
-		"success": true,
-		"meta": map[string]any{
-			"total":    total,
-			"upserted": upserted,
+	observedAt := utcNowOr(payload.ObservedAt)
+	writes := make([]SubmissionWrite, len(snapshots))
+	for index, snapshot := range snapshots {
+		writes[index] = SubmissionWrite{Snapshot: snapshot, ObservedAt: observedAt}
+	}
+
+	return &submissionIngest{
+		writes:  writes,
+		failure: "failed to ingest participant submissions response",
+		ack: func(updates []*SubmissionUpdateResult) map[string]any {
+			logInfo(
+				"participant.submissions.ingested",
+				"source", "extension.intercepted_participant_submissions_response",
+				"url", payload.URL,
+				"total", total,
+				"upserted", len(updates),
+				"rejected", len(rejected),
+			)
+			s.recordRejections(payload.Route, rejected)
+			return map[string]any{
+				"success": true,
+				"meta": map[string]any{
+					"total":    total,
+					"upserted": len(updates),
+				},
+				"rejected": rejected,
+			}
 		},
 	}, nil
 }
+
+func (s *Service) applySubmissionIngest(ingest *submissionIngest) (map[string]any, error) {
+	acks, err := s.applySubmissionIngests([]*submissionIngest{ingest})
+	if err != nil {
+		return nil, badRequest(ingest.failure)
+	}
+	return acks[0], nil
+}
+
+// applySubmissionIngests stores the writes of every ingest in one
+// transaction, pushes the resulting changes and returns each ingest's ack.
+func (s *Service) applySubmissionIngests(ingests []*submissionIngest) ([]map[string]any, error) {
+	var writes []SubmissionWrite
+	for _, ingest := range ingests {
+		writes = append(writes, ingest.writes...)
+	}
+
+	var updates []*SubmissionUpdateResult
+	if len(writes) > 0 {
+		stored, err := s.submissionsStore.UpsertSnapshots(writes)
+		if err != nil {
+			logWarn("submissions.store_failed", "ingests", len(ingests), "writes", len(writes), "error", err)
+			return nil, err
+		}
+		updates = stored
+	}
+
+	acks := make([]map[string]any, len(ingests))
+	for index, ingest := range ingests {
+		own := updates[:len(ingest.writes)]
+		updates = updates[len(ingest.writes):]
+		for _, update := range own {
+			if update.StatusChanged || ingest.announceNew && update.FirstSeen {
+				s.broadcastSubmissionUpdate(*update)
+			}
+		}
+		acks[index] = ingest.ack(own)
+	}
+	return acks, nil
+}
+
+type studyDetailResponse struct {
+	study normalizedStudy
+	raw   json.RawMessage
+}
+
+// decodeStudyDetailBody validates a study-detail response like a listing
+// item. The id may be left out of the body, since the URL carries it.
+func decodeStudyDetailBody(response interceptedResponse) (studyDetailResponse, error) {
+	body, err := requireBody(response)
+	if err != nil {
+		return studyDetailResponse{}, err
+	}
+
+	var parsed apiStudy
+	if err := decodeItem(body, &parsed); err != nil {
+		return studyDetailResponse{}, err
+	}
+	if parsed.ID == "" {
+		parsed.ID = response.Params["study_id"]
+	}
+	if parsed.ID != response.Params["study_id"] {
+		return studyDetailResponse{}, invalidField("id", "does not match url")
+	}
+	if err := validateAPIStudy(parsed); err != nil {
+		return studyDetailResponse{}, err
+	}
+	return studyDetailResponse{study: normalizeAPIStudy(parsed), raw: body}, nil
+}
+
+func (s *Service) processReceiveStudyDetailResponse(payload interceptedResponse) (map[string]any, error) {
+	if payload.StatusCode != 0 && payload.StatusCode != http.StatusOK {
+		return map[string]any{"success": true, "ignored": true, "status_code": payload.StatusCode}, nil
+	}
+	detail, err := decodeStudyDetailBody(payload)
+	if err != nil {
+		var invalid *itemValidationError
+		if errors.As(err, &invalid) {
+			logWarn("study.detail.rejected", "study_id", payload.Params["study_id"], "url", payload.URL, "error", err)
+			s.recordRejections(payload.Route, []rejectedItem{rejectItem(0, payload.Params["study_id"], err)})
+			return nil, badRequest("invalid study detail: " + invalid.Error())
+		}
+		return nil, err
+	}
+
+	if err := s.studiesStore.StoreStudyEnrichment(detail.study, detail.raw, payload.ObservedAt); err != nil {
+		logWarn("study.detail.persist_failed", "study_id", detail.study.ID, "url", payload.URL, "error", err)
+		return nil, internalServerError("failed to persist study detail")
+	}
+
+	logInfo("study.detail.ingested", "study_id", detail.study.ID, "url", payload.URL)
+	return map[string]any{"success": true, "study_id": detail.study.ID}, nil
+}
+
+func (s *Service) processReceiveBalanceResponse(payload interceptedResponse) (map[string]any, error) {
+	if s.balancesStore == nil {
+		return nil, serviceUnavailable("balances store not configured")
+	}
+	if payload.StatusCode != 0 && payload.StatusCode != http.StatusOK {
+		return map[string]any{"success": true, "ignored": true, "status_code": payload.StatusCode}, nil
+	}
+	snapshot, err := decodeBalanceBody(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	change, err := s.balancesStore.Record(&snapshot)
+	if errors.Is(err, errPartialBalance) {
+		logWarn("balance.partial_rejected", "url", payload.URL)
+		return nil, badRequest(err.Error())
+	}
+	if err != nil {
+		logWarn("balance.persist_failed", "url", payload.URL, "error", err)
+		return nil, internalServerError("failed to persist balance")
+	}
+
+	response := map[string]any{"success": true, "balance": snapshot}
+	if change != nil {
+		response["change"] = change
+		logInfo(
+			"balance.changed",
+			"kind", change.Kind,
+			"available", snapshot.Available,
+			"pending", snapshot.Pending,
+			"currency", snapshot.Currency,
+			"available_delta", change.AvailableDelta,
+			"pending_delta", change.PendingDelta,
+		)
+		s.broadcastBalanceChangedEvent(*change)
+	}
+	return response, nil
+}
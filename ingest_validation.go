@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRecentRejections is how many rejected items are kept per endpoint for
+// the debug view.
+const maxRecentRejections = 20
+
+// rejectedItem describes one list item an ingest dropped instead of storing.
+type rejectedItem struct {
+	Index  int    `json:"index"`
+	ID     string `json:"id,omitempty"`
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// itemValidationError is returned by the item normalizers when a field is
+// missing or malformed.
+type itemValidationError struct {
+	field  string
+	reason string
+}
+
+func (e *itemValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.field, e.reason)
+}
+
+func invalidField(field, reason string) *itemValidationError {
+	return &itemValidationError{field: field, reason: reason}
+}
+
+// decodeItem unmarshals one list item, reporting type mismatches against the
+// offending field.
+func decodeItem(raw json.RawMessage, dst any) error {
+	err := json.Unmarshal(raw, dst)
+	if err == nil {
+		return nil
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return invalidField(typeErr.Field, fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value))
+	}
+	return invalidField("", "item is not a valid JSON object")
+}
+
+func rejectItem(index int, id string, err error) rejectedItem {
+	rejected := rejectedItem{Index: index, ID: strings.TrimSpace(id), Reason: err.Error()}
+	var invalid *itemValidationError
+	if errors.As(err, &invalid) {
+		rejected.Field = invalid.field
+		rejected.Reason = invalid.reason
+	}
+	return rejected
+}
+
+// itemID pulls the id out of a list item that failed to decode, so the
+// rejection can still name it.
+func itemID(raw json.RawMessage) string {
+	var probe struct {
+		ID any `json:"id"`
+	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return ""
+	}
+	if id, ok := probe.ID.(string); ok {
+		return id
+	}
+	return ""
+}
+
+// decodeAPIStudy decodes and validates one raw Prolific study object.
+func decodeAPIStudy(raw json.RawMessage) (apiStudy, error) {
+	var study apiStudy
+	if err := decodeItem(raw, &study); err != nil {
+		return apiStudy{}, err
+	}
+	if err := validateAPIStudy(study); err != nil {
+		return apiStudy{}, err
+	}
+	return study, nil
+}
+
+func validateAPIStudy(study apiStudy) error {
+	switch {
+	case strings.TrimSpace(study.ID) == "":
+		return invalidField("id", "required")
+	case strings.TrimSpace(study.Name) == "":
+		return invalidField("name", "required")
+	case study.TotalAvailablePlaces < 0:
+		return invalidField("total_available_places", "must not be negative")
+	case study.PlacesTaken < 0:
+		return invalidField("places_taken", "must not be negative")
+	case study.StudyReward.Amount < 0:
+		return invalidField("study_reward.amount", "must not be negative")
+	case study.EstimatedCompletionTime < 0:
+		return invalidField("estimated_completion_time", "must not be negative")
+	}
+	return nil
+}
+
+type endpointRejections struct {
+	Count          int            `json:"count"`
+	LastRejectedAt time.Time      `json:"last_rejected_at"`
+	Recent         []rejectedItem `json:"recent"`
+}
+
+type ingestRejections struct {
+	mu         sync.Mutex
+	byEndpoint map[string]*endpointRejections
+}
+
+func (r *ingestRejections) record(endpoint string, rejected []rejectedItem) {
+	if len(rejected) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.byEndpoint == nil {
+		r.byEndpoint = make(map[string]*endpointRejections)
+	}
+	stats := r.byEndpoint[endpoint]
+	if stats == nil {
+		stats = &endpointRejections{}
+		r.byEndpoint[endpoint] = stats
+	}
+	stats.Count += len(rejected)
+	stats.LastRejectedAt = time.Now().UTC()
+	stats.Recent = append(stats.Recent, rejected...)
+	if overflow := len(stats.Recent) - maxRecentRejections; overflow > 0 {
+		stats.Recent = append([]rejectedItem(nil), stats.Recent[overflow:]...)
+	}
+}
+
+func (r *ingestRejections) snapshot() map[string]endpointRejections {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := make(map[string]endpointRejections, len(r.byEndpoint))
+	for endpoint, stats := range r.byEndpoint {
+		copied := *stats
+		copied.Recent = append([]rejectedItem(nil), stats.Recent...)
+		snapshot[endpoint] = copied
+	}
+	return snapshot
+}
+
+func (s *Service) recordRejections(endpoint string, rejected []rejectedItem) {
+	for _, item := range rejected {
+		logWarn("ingest.item_rejected", "endpoint", endpoint, "index", item.Index, "id", item.ID, "field", item.Field, "reason", item.Reason)
+	}
+	s.ingestRejections.record(endpoint, rejected)
+}
+
+func (s *Service) handleDebugIngestRejections(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"endpoints": s.ingestRejections.snapshot(),
+	})
+}
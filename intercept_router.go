@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// urlMatcher matches intercepted Prolific URLs by host and path pattern.
+// Pattern segments written as {name} match any non-empty segment and are
+// returned as path params. A trailing slash is optional on input unless
+// exactSlash is set, and always present on the normalized URL.
+type urlMatcher struct {
+	host      string
+	path      string
+	keepQuery bool
+	// exactSlash requires the trailing slash, as the reserve endpoint always
+	// has.
+	exactSlash bool
+}
+
+type urlMatch struct {
+	url    string
+	params map[string]string
+}
+
+func (m urlMatcher) match(raw string) (urlMatch, bool) {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || parsed == nil {
+		return urlMatch{}, false
+	}
+	if !strings.EqualFold(parsed.Scheme, "https") || !strings.EqualFold(strings.TrimSpace(parsed.Hostname()), m.host) {
+		return urlMatch{}, false
+	}
+	if m.exactSlash && !strings.HasSuffix(parsed.Path, "/") {
+		return urlMatch{}, false
+	}
+
+	patternParts := strings.Split(strings.Trim(m.path, "/"), "/")
+	pathParts := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	if len(patternParts) != len(pathParts) {
+		return urlMatch{}, false
+	}
+
+	params := map[string]string{}
+	for i, part := range patternParts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			if pathParts[i] == "" {
+				return urlMatch{}, false
+			}
+			params[strings.Trim(part, "{}")] = pathParts[i]
+			continue
+		}
+		if part != pathParts[i] {
+			return urlMatch{}, false
+		}
+	}
+
+	parsed.Path = "/" + strings.Join(pathParts, "/") + "/"
+	parsed.RawPath = ""
+	if !m.keepQuery {
+		parsed.RawQuery = ""
+	}
+	return urlMatch{url: parsed.String(), params: params}, true
+}
+
+// interceptedResponse is an intercepted payload whose URL has been matched
+// and normalized by the router.
+type interceptedResponse struct {
+	interceptedResponsePayload
+	Route  string
+	Params map[string]string
+}
+
+// interceptRoute pairs a URL matcher with the processor for one Prolific
+// endpoint. Processors decode the body themselves, since most must check
+// the status code before the body is worth decoding. wsType names the dedicated message type older extension
+// builds send for this endpoint; new endpoints only need the generic
+// receive-intercepted-response message.
+type interceptRoute struct {
+	name     string
+	wsType   string
+	urlError string
+	matcher  urlMatcher
+	handle   func(interceptedResponse) (map[string]any, error)
+	// prepareSubmissions is set on submission routes, whose writes a batch
+	// stores together in one transaction.
+	prepareSubmissions func(interceptedResponse) (*submissionIngest, error)
+}
+
+func newInterceptRoute(name string, matcher urlMatcher, handle func(interceptedResponse) (map[string]any, error)) interceptRoute {
+	return interceptRoute{name: name, matcher: matcher, handle: handle}
+}
+
+func (r interceptRoute) legacy(wsType, urlError string) interceptRoute {
+	r.wsType = wsType
+	r.urlError = urlError
+	return r
+}
+
+func (r interceptRoute) submissions(prepare func(interceptedResponse) (*submissionIngest, error)) interceptRoute {
+	r.prepareSubmissions = prepare
+	return r
+}
+
+// requireBody rejects intercepted responses that carry no body.
+func requireBody(response interceptedResponse) (json.RawMessage, error) {
+	if len(response.Body) == 0 {
+		return nil, badRequest("body cannot be empty")
+	}
+	return response.Body, nil
+}
+
+var studiesCollectionMatcher = urlMatcher{host: internalStudiesHost, path: internalStudiesPath, keepQuery: true}
+
+func normalizeStudiesCollectionURL(raw string) (string, bool) {
+	matched, ok := studiesCollectionMatcher.match(raw)
+	return matched.url, ok
+}
+
+func (s *Service) registerInterceptRoutes() {
+	s.interceptRoutes = []interceptRoute{
+		newInterceptRoute("studies", studiesCollectionMatcher, s.processReceiveStudiesResponse).
+			legacy(wsTypeStudiesResponse, "url must target internal studies endpoint"),
+		newInterceptRoute("study.detail",
+			urlMatcher{host: internalStudiesHost, path: internalStudiesPath + "{study_id}/"},
+			s.processReceiveStudyDetailResponse),
+		newInterceptRoute("study.detail",
+			urlMatcher{host: internalStudiesHost, path: "/api/v1/studies/{study_id}/"},
+			s.processReceiveStudyDetailResponse),
+		newInterceptRoute("submission.reserve",
+			urlMatcher{host: internalStudiesHost, path: "/api/v1/submissions/reserve/", exactSlash: true},
+			s.processReceiveSubmissionResponse).
+			legacy(wsTypeSubmission, "url must target internal submissions endpoint").
+			submissions(s.prepareSubmissionResponse),
+		newInterceptRoute("submission.transition",
+			urlMatcher{host: internalStudiesHost, path: "/api/v1/submissions/{submission_id}/transition/"},
+			s.processReceiveSubmissionResponse).
+			legacy(wsTypeSubmission, "url must target internal submissions endpoint").
+			submissions(s.prepareSubmissionResponse),
+		newInterceptRoute("participant.submissions",
+			urlMatcher{host: internalStudiesHost, path: internalParticipantSubmissionsPath, keepQuery: true},
+			s.processReceiveParticipantSubmissionsResponse).
+			legacy(wsTypeParticipantSubs, "url must target participant submissions endpoint").
+			submissions(s.prepareParticipantSubmissions),
+		newInterceptRoute("participant.balance",
+			urlMatcher{host: internalStudiesHost, path: "/api/v1/users/{user_id}/balance/"},
+			s.processReceiveBalanceResponse),
+	}
+}
+
+// routeInterceptedResponse finds the route for payload.URL and runs it. When
+// wsType is set only routes registered for that dedicated message type are
+// considered, so legacy messages keep their URL validation.
+func (s *Service) routeInterceptedResponse(payload interceptedResponsePayload, wsType string) (map[string]any, error) {
+	route, response, err := s.matchInterceptRoute(payload, wsType)
+	if err != nil {
+		return nil, err
+	}
+
+	s.observeSchema(route.name, response.interceptedResponsePayload)
+	result, err := route.handle(response)
+	if err != nil {
+		return nil, err
+	}
+	return route.tagResult(result, wsType), nil
+}
+
+// matchInterceptRoute finds the route for payload.URL without running it.
+func (s *Service) matchInterceptRoute(payload interceptedResponsePayload, wsType string) (interceptRoute, interceptedResponse, error) {
+	urlError := ""
+	for _, route := range s.interceptRoutes {
+		if wsType != "" && route.wsType != wsType {
+			continue
+		}
+		if wsType != "" && urlError == "" {
+			urlError = route.urlError
+		}
+		matched, ok := route.matcher.match(payload.URL)
+		if !ok {
+			continue
+		}
+
+		payload.URL = matched.url
+		return route, interceptedResponse{
+			interceptedResponsePayload: payload,
+			Route:                      route.name,
+			Params:                     matched.params,
+		}, nil
+	}
+
+	if urlError == "" {
+		urlError = fmt.Sprintf("no intercept route for url %q", payload.URL)
+	}
+	return interceptRoute{}, interceptedResponse{}, badRequest(urlError)
+}
+
+// tagResult names the route in results of the generic message, whose sender
+// does not know which route it reached.
+func (r interceptRoute) tagResult(result map[string]any, wsType string) map[string]any {
+	if wsType == "" && result != nil {
+		result["route"] = r.name
+	}
+	return result
+}
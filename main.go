@@ -6,6 +6,10 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
 	db, err := openSQLite(sqliteDBPath)
 	if err != nil {
 		logError("service.start_failed", "error", err)
@@ -16,13 +20,22 @@ func main() {
 	studiesStore := NewStudiesStore(db)
 	submissionsStore := NewSubmissionsStore(db)
 	stateStore := NewServiceStateStore(db)
+	analyticsStore := NewAnalyticsStore(db)
+	balancesStore := NewBalancesStore(db)
+
+	config := loadServiceConfig()
+	var capturesStore *CapturesStore
+	if config.CaptureRaw {
+		capturesStore = NewCapturesStore(db)
+	}
+	service := NewService(config, studiesStore, submissionsStore, stateStore, analyticsStore, balancesStore, capturesStore, NewSchemaDriftStore(db), NewWSEventsStore(db), NewTokensStore(db))
 
-	service := NewService(studiesStore, submissionsStore, stateStore)
+	service.announcePairing()
 
 	mux := http.NewServeMux()
 	service.RegisterRoutes(mux)
 
-	logInfo("service.start", "listen_addr", listenAddr, "sqlite_db", sqliteDBPath)
+	logInfo("service.start", "listen_addr", listenAddr, "sqlite_db", sqliteDBPath, "reopen_flicker_window", config.ReopenFlickerWindow, "capture_raw", config.CaptureRaw, "auth", config.AuthRequired)
 	if err := http.ListenAndServe(listenAddr, mux); err != nil {
 		logError("service.exit", "error", err)
 		os.Exit(1)
@@ -20,6 +20,22 @@ type StudiesRefreshUpdate struct {
 	StatusCode                int               `json:"status_code"`
 	NewlyAvailableStudies     []normalizedStudy `json:"newly_available_studies,omitempty"`
 	BecameUnavailableStudyIDs []string          `json:"became_unavailable_study_ids,omitempty"`
+	UpdatedStudies            []UpdatedStudy    `json:"updated_studies,omitempty"`
+	ReopenedStudies           []ReopenedStudy   `json:"reopened_studies,omitempty"`
+	Quarantined               bool              `json:"quarantined,omitempty"`
+}
+
+type ReopenedStudy struct {
+	Study       normalizedStudy `json:"study"`
+	GapSeconds  int64           `json:"gap_seconds"`
+	ReopenCount int             `json:"reopen_count"`
+	Flicker     bool            `json:"flicker,omitempty"`
+}
+
+type UpdatedStudy struct {
+	Study          normalizedStudy    `json:"study"`
+	Changes        []StudyFieldChange `json:"changes"`
+	RewardIncrease bool               `json:"reward_increase,omitempty"`
 }
 
 const (
@@ -56,4 +72,8 @@ type SubmissionUpdateResult struct {
 	Status       string    `json:"status"`
 	Phase        string    `json:"phase"`
 	ObservedAt   time.Time `json:"observed_at"`
+
+	PreviousStatus string `json:"previous_status,omitempty"`
+	StatusChanged  bool   `json:"status_changed"`
+	FirstSeen      bool   `json:"first_seen,omitempty"`
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const notifyTimeout = 15 * time.Second
+
+type notification struct {
+	Title  string `json:"title"`
+	Format string `json:"format"`
+	Body   string `json:"body"`
+}
+
+type notifier interface {
+	Notify(ctx context.Context, n notification) error
+}
+
+// webhookNotifier POSTs each notification as JSON to a fixed URL.
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func newNotifier(config serviceConfig) notifier {
+	if config.NotifyWebhookURL == "" {
+		return nil
+	}
+	return &webhookNotifier{
+		url:    config.NotifyWebhookURL,
+		client: &http.Client{Timeout: notifyTimeout},
+	}
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, message notification) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("marshal notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send notification: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notification webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+var errNotifierNotConfigured = errors.New("no notifier configured (set PROLIFIC_PULSE_NOTIFY_WEBHOOK_URL)")
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+const (
+	reportFormatMarkdown = "markdown"
+	reportFormatHTML     = "html"
+
+	dailyReportBestHourlyLimit = 10
+)
+
+type DailyReportStudy struct {
+	StudyID          string    `json:"study_id"`
+	Name             string    `json:"name"`
+	Researcher       string    `json:"researcher,omitempty"`
+	Reward           apiMoney  `json:"reward"`
+	HourlyReward     apiMoney  `json:"average_reward_per_hour"`
+	EstimatedMinutes int       `json:"estimated_completion_time"`
+	FirstSeenAt      time.Time `json:"first_seen_at"`
+	GoneAt           time.Time `json:"gone_at,omitempty"`
+	AvailableSeconds int64     `json:"available_seconds"`
+	StillAvailable   bool      `json:"still_available,omitempty"`
+}
+
+type DailyReport struct {
+	Date                 string               `json:"date"`
+	GeneratedAt          time.Time            `json:"generated_at"`
+	StudiesSeen          int                  `json:"studies_seen"`
+	BestHourly           []DailyReportStudy   `json:"best_hourly"`
+	SubmissionsStarted   int                  `json:"submissions_started"`
+	SubmissionsCompleted int                  `json:"submissions_completed"`
+	Earned               []apiMoney           `json:"earned"`
+	Pending              []apiMoney           `json:"pending"`
+	MissedPriority       []DailyReportStudy   `json:"missed_priority_matches"`
+	PriorityFilter       priorityFilterConfig `json:"priority_filter"`
+}
+
+type dailyReportSubmissionPayload struct {
+	StartedAt         *string    `json:"started_at"`
+	CompletedAt       *string    `json:"completed_at"`
+	ReturnedAt        *string    `json:"returned_at"`
+	SubmissionReward  *apiMoney  `json:"submission_reward"`
+	SubmissionBonuses []apiMoney `json:"submission_bonuses"`
+}
+
+// BuildDailyReport summarises the local calendar day that contains day.
+func (s *AnalyticsStore) BuildDailyReport(day time.Time, filter priorityFilterConfig) (*DailyReport, error) {
+	local := day.In(time.Local)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)
+	end := start.AddDate(0, 0, 1)
+
+	report := &DailyReport{
+		Date:           start.Format(time.DateOnly),
+		GeneratedAt:    time.Now().UTC(),
+		BestHourly:     make([]DailyReportStudy, 0),
+		Earned:         make([]apiMoney, 0),
+		Pending:        make([]apiMoney, 0),
+		MissedPriority: make([]DailyReportStudy, 0),
+		PriorityFilter: filter,
+	}
+
+	seen, err := s.loadStudiesSeen(start, end)
+	if err != nil {
+		return nil, err
+	}
+	report.StudiesSeen = len(seen)
+
+	submittedStudyIDs, err := s.accumulateDailySubmissions(report, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	studies := make([]DailyReportStudy, 0, len(seen))
+	for _, entry := range seen {
+		studies = append(studies, entry.summary)
+		if !filter.Matches(entry.study) {
+			continue
+		}
+		if _, submitted := submittedStudyIDs[entry.summary.StudyID]; submitted {
+			continue
+		}
+		report.MissedPriority = append(report.MissedPriority, entry.summary)
+	}
+
+	sort.Slice(studies, func(i, j int) bool {
+		if studies[i].HourlyReward.Amount != studies[j].HourlyReward.Amount {
+			return studies[i].HourlyReward.Amount > studies[j].HourlyReward.Amount
+		}
+		return studies[i].StudyID < studies[j].StudyID
+	})
+	if len(studies) > dailyReportBestHourlyLimit {
+		studies = studies[:dailyReportBestHourlyLimit]
+	}
+	report.BestHourly = studies
+
+	sort.Slice(report.MissedPriority, func(i, j int) bool {
+		return report.MissedPriority[i].FirstSeenAt.Before(report.MissedPriority[j].FirstSeenAt)
+	})
+	return report, nil
+}
+
+type dailySeenStudy struct {
+	study   normalizedStudy
+	summary DailyReportStudy
+}
+
+func (s *AnalyticsStore) loadStudiesSeen(start, end time.Time) (map[string]*dailySeenStudy, error) {
+	rows, err := s.db.Query(
+		`SELECT h.study_id, MIN(h.observed_at), MAX(h.observed_at), l.payload_json
+		 FROM studies_history h
+		 LEFT JOIN studies_latest l ON l.study_id = h.study_id
+		 WHERE h.observed_at >= ? AND h.observed_at < ?
+		 GROUP BY h.study_id`,
+		formatTime(start),
+		formatTime(end),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query studies seen: %w", err)
+	}
+	defer rows.Close()
+
+	seen := map[string]*dailySeenStudy{}
+	for rows.Next() {
+		var (
+			studyID     string
+			firstSeenAt string
+			lastSeenAt  string
+			payloadJSON sql.NullString
+		)
+		if err := rows.Scan(&studyID, &firstSeenAt, &lastSeenAt, &payloadJSON); err != nil {
+			return nil, fmt.Errorf("scan studies seen: %w", err)
+		}
+
+		entry := &dailySeenStudy{}
+		if payloadJSON.Valid && payloadJSON.String != "" {
+			_ = json.Unmarshal([]byte(payloadJSON.String), &entry.study)
+		}
+		entry.summary = DailyReportStudy{
+			StudyID:          studyID,
+			Name:             entry.study.Name,
+			Researcher:       entry.study.Researcher.Name,
+			Reward:           entry.study.Reward,
+			HourlyReward:     entry.study.AverageRewardPerHour,
+			EstimatedMinutes: entry.study.EstimatedCompletionTime,
+			FirstSeenAt:      parseTime(firstSeenAt),
+			GoneAt:           parseTime(lastSeenAt),
+		}
+		seen[studyID] = entry
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate studies seen: %w", err)
+	}
+
+	if err := s.applyDailyDisappearances(seen, start, end); err != nil {
+		return nil, err
+	}
+	return seen, nil
+}
+
+// applyDailyDisappearances replaces the last-seen approximation with the
+// recorded 'unavailable' event when there is one, and flags studies that
+// are still listed.
+func (s *AnalyticsStore) applyDailyDisappearances(seen map[string]*dailySeenStudy, start, end time.Time) error {
+	rows, err := s.db.Query(
+		`SELECT study_id, observed_at
+		 FROM study_availability_events
+		 WHERE event_type = 'unavailable' AND observed_at >= ? AND observed_at < ?
+		 ORDER BY row_id ASC`,
+		formatTime(start),
+		formatTime(end.Add(24*time.Hour)),
+	)
+	if err != nil {
+		return fmt.Errorf("query daily disappearances: %w", err)
+	}
+	defer rows.Close()
+
+	resolved := map[string]bool{}
+	for rows.Next() {
+		var studyID, observedAt string
+		if err := rows.Scan(&studyID, &observedAt); err != nil {
+			return fmt.Errorf("scan daily disappearance: %w", err)
+		}
+		entry, ok := seen[studyID]
+		if !ok || resolved[studyID] {
+			continue
+		}
+		goneAt := parseTime(observedAt)
+		if goneAt.Before(entry.summary.FirstSeenAt) {
+			continue
+		}
+		entry.summary.GoneAt = goneAt
+		resolved[studyID] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate daily disappearances: %w", err)
+	}
+
+	active, err := s.db.Query(`SELECT study_id FROM studies_active_snapshot`)
+	if err != nil {
+		return fmt.Errorf("query active snapshot: %w", err)
+	}
+	defer active.Close()
+	for active.Next() {
+		var studyID string
+		if err := active.Scan(&studyID); err != nil {
+			return fmt.Errorf("scan active snapshot: %w", err)
+		}
+		if entry, ok := seen[studyID]; ok && !resolved[studyID] {
+			entry.summary.StillAvailable = true
+		}
+	}
+	if err := active.Err(); err != nil {
+		return fmt.Errorf("iterate active snapshot: %w", err)
+	}
+
+	for _, entry := range seen {
+		if entry.summary.GoneAt.After(entry.summary.FirstSeenAt) {
+			entry.summary.AvailableSeconds = int64(entry.summary.GoneAt.Sub(entry.summary.FirstSeenAt) / time.Second)
+		}
+		if entry.summary.StillAvailable {
+			entry.summary.GoneAt = time.Time{}
+		}
+	}
+	return nil
+}
+
+func (s *AnalyticsStore) accumulateDailySubmissions(report *DailyReport, start, end time.Time) (map[string]struct{}, error) {
+	rows, err := s.db.Query(`SELECT study_id, status, phase, observed_at, approved_at, payload_json FROM submissions`)
+	if err != nil {
+		return nil, fmt.Errorf("query daily submissions: %w", err)
+	}
+	defer rows.Close()
+
+	inDay := func(t time.Time) bool {
+		return !t.IsZero() && !t.Before(start) && t.Before(end)
+	}
+
+	studyIDs := map[string]struct{}{}
+	earned := map[string]float64{}
+	pending := map[string]float64{}
+	for rows.Next() {
+		var studyID, status, phase, observedAtText, payloadJSON string
+		var approvedAtText sql.NullString
+		if err := rows.Scan(&studyID, &status, &phase, &observedAtText, &approvedAtText, &payloadJSON); err != nil {
+			return nil, fmt.Errorf("scan daily submission: %w", err)
+		}
+		studyIDs[studyID] = struct{}{}
+
+		var payload dailyReportSubmissionPayload
+		_ = json.Unmarshal([]byte(payloadJSON), &payload)
+		observedAt := parseTime(observedAtText)
+
+		startedAt := parseOptionalTime(payload.StartedAt)
+		if startedAt.IsZero() && phase == SubmissionPhaseSubmitting {
+			startedAt = observedAt
+		}
+		if inDay(startedAt) {
+			report.SubmissionsStarted++
+		}
+
+		if phase != SubmissionPhaseSubmitted || status == "RETURNED" {
+			continue
+		}
+		completedAt := parseOptionalTime(payload.CompletedAt)
+		if completedAt.IsZero() {
+			completedAt = observedAt
+		}
+		if inDay(completedAt) {
+			report.SubmissionsCompleted++
+		}
+
+		// Earnings belong to the day the approval was observed. Submissions
+		// that were already approved when first seen fall back to completion.
+		var bucket map[string]float64
+		switch status {
+		case "APPROVED":
+			approvedAt := completedAt
+			if approvedAtText.Valid {
+				approvedAt = parseTime(approvedAtText.String)
+			}
+			if !inDay(approvedAt) {
+				continue
+			}
+			bucket = earned
+		case "AWAITING REVIEW":
+			if !inDay(completedAt) {
+				continue
+			}
+			bucket = pending
+		default:
+			continue
+		}
+		if payload.SubmissionReward != nil {
+			bucket[payload.SubmissionReward.Currency] += payload.SubmissionReward.Amount
+		}
+		for _, bonus := range payload.SubmissionBonuses {
+			bucket[bonus.Currency] += bonus.Amount
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate daily submissions: %w", err)
+	}
+
+	report.Earned = moneyTotals(earned)
+	report.Pending = moneyTotals(pending)
+	return studyIDs, nil
+}
+
+func parseOptionalTime(raw *string) time.Time {
+	if raw == nil {
+		return time.Time{}
+	}
+	return parseTime(strings.TrimSpace(*raw))
+}
+
+func moneyTotals(totals map[string]float64) []apiMoney {
+	result := make([]apiMoney, 0, len(totals))
+	for currency, amount := range totals {
+		result = append(result, apiMoney{Amount: amount, Currency: currency})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Currency < result[j].Currency })
+	return result
+}
+
+func formatMoney(money apiMoney) string {
+	currency := strings.TrimSpace(money.Currency)
+	if currency == "" {
+		return fmt.Sprintf("%.2f", money.Amount/100)
+	}
+	return fmt.Sprintf("%.2f %s", money.Amount/100, currency)
+}
+
+func formatMoneyList(list []apiMoney) string {
+	if len(list) == 0 {
+		return "0.00"
+	}
+	parts := make([]string, 0, len(list))
+	for _, money := range list {
+		parts = append(parts, formatMoney(money))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatSeconds(seconds int64) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+var reportTemplateFuncs = map[string]any{
+	"money":     formatMoney,
+	"moneyList": formatMoneyList,
+	"seconds":   formatSeconds,
+	"clock": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.In(time.Local).Format("15:04")
+	},
+}
+
+const dailyReportMarkdownTemplate = `# Prolific Pulse daily digest — {{.Date}}
+
+- Studies seen: {{.StudiesSeen}}
+- Submissions started: {{.SubmissionsStarted}}
+- Submissions completed: {{.SubmissionsCompleted}}
+- Earned (approved): {{moneyList .Earned}}
+- Pending review: {{moneyList .Pending}}
+
+## Best hourly studies
+{{if .BestHourly}}
+| Study | Researcher | Reward | Hourly | Est. min | First seen | Lasted |
+| --- | --- | --- | --- | --- | --- | --- |
+{{range .BestHourly}}| {{.Name}} | {{.Researcher}} | {{money .Reward}} | {{money .HourlyReward}} | {{.EstimatedMinutes}} | {{clock .FirstSeenAt}} | {{seconds .AvailableSeconds}}{{if .StillAvailable}} (still open){{end}} |
+{{end}}{{else}}
+No studies seen.
+{{end}}
+## Missed priority matches
+{{if .MissedPriority}}
+| Study | Reward | Hourly | Est. min | First seen | Lasted |
+| --- | --- | --- | --- | --- | --- |
+{{range .MissedPriority}}| {{.Name}} | {{money .Reward}} | {{money .HourlyReward}} | {{.EstimatedMinutes}} | {{clock .FirstSeenAt}} | {{seconds .AvailableSeconds}}{{if .StillAvailable}} (still open){{end}} |
+{{end}}{{else}}
+None.
+{{end}}`
+
+const dailyReportHTMLTemplate = `<!doctype html>
+<html><head><meta charset="utf-8"><title>Prolific Pulse daily digest — {{.Date}}</title></head>
+<body>
+<h1>Prolific Pulse daily digest — {{.Date}}</h1>
+<ul>
+<li>Studies seen: {{.StudiesSeen}}</li>
+<li>Submissions started: {{.SubmissionsStarted}}</li>
+<li>Submissions completed: {{.SubmissionsCompleted}}</li>
+<li>Earned (approved): {{moneyList .Earned}}</li>
+<li>Pending review: {{moneyList .Pending}}</li>
+</ul>
+<h2>Best hourly studies</h2>
+{{if .BestHourly}}<table>
+<tr><th>Study</th><th>Researcher</th><th>Reward</th><th>Hourly</th><th>Est. min</th><th>First seen</th><th>Lasted</th></tr>
+{{range .BestHourly}}<tr><td>{{.Name}}</td><td>{{.Researcher}}</td><td>{{money .Reward}}</td><td>{{money .HourlyReward}}</td><td>{{.EstimatedMinutes}}</td><td>{{clock .FirstSeenAt}}</td><td>{{seconds .AvailableSeconds}}{{if .StillAvailable}} (still open){{end}}</td></tr>
+{{end}}</table>{{else}}<p>No studies seen.</p>{{end}}
+<h2>Missed priority matches</h2>
+{{if .MissedPriority}}<table>
+<tr><th>Study</th><th>Reward</th><th>Hourly</th><th>Est. min</th><th>First seen</th><th>Lasted</th></tr>
+{{range .MissedPriority}}<tr><td>{{.Name}}</td><td>{{money .Reward}}</td><td>{{money .HourlyReward}}</td><td>{{.EstimatedMinutes}}</td><td>{{clock .FirstSeenAt}}</td><td>{{seconds .AvailableSeconds}}{{if .StillAvailable}} (still open){{end}}</td></tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}
+</body></html>
+`
+
+var (
+	dailyReportMarkdown = texttemplate.Must(texttemplate.New("daily.md").Funcs(reportTemplateFuncs).Parse(dailyReportMarkdownTemplate))
+	dailyReportHTML     = htmltemplate.Must(htmltemplate.New("daily.html").Funcs(reportTemplateFuncs).Parse(dailyReportHTMLTemplate))
+)
+
+func normalizeReportFormat(raw string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "", "md", reportFormatMarkdown:
+		return reportFormatMarkdown, true
+	case reportFormatHTML:
+		return reportFormatHTML, true
+	default:
+		return "", false
+	}
+}
+
+func renderDailyReport(report *DailyReport, format string) (string, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case reportFormatHTML:
+		err = dailyReportHTML.Execute(&buf, report)
+	default:
+		err = dailyReportMarkdown.Execute(&buf, report)
+	}
+	if err != nil {
+		return "", fmt.Errorf("render daily report: %w", err)
+	}
+	return buf.String(), nil
+}
+
+func parseReportDate(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Now(), nil
+	}
+	parsed, err := time.ParseInLocation(time.DateOnly, raw, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("date must be formatted as YYYY-MM-DD")
+	}
+	return parsed, nil
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSchemaDriftLimit = 200
+	maxSchemaDriftLimit     = 5000
+	// maxSchemaPaths caps how many field paths one response contributes, so
+	// objects keyed by ids cannot flood the table.
+	maxSchemaPaths = 2000
+
+	schemaChangeAdded       = "added"
+	schemaChangeRemoved     = "removed"
+	schemaChangeTypeChanged = "type_changed"
+)
+
+// SchemaDriftStore remembers the field paths and JSON types seen per
+// intercept route and records how they change. Paths use dots for object
+// keys and [] for array items, e.g. results[].study_reward.amount.
+type SchemaDriftStore struct {
+	db *sql.DB
+
+	mu    sync.Mutex
+	known map[string]map[string]string
+}
+
+func NewSchemaDriftStore(db *sql.DB) *SchemaDriftStore {
+	return &SchemaDriftStore{db: db, known: make(map[string]map[string]string)}
+}
+
+type SchemaDrift struct {
+	Endpoint    string    `json:"endpoint"`
+	Path        string    `json:"path"`
+	Change      string    `json:"change"`
+	OldType     string    `json:"old_type,omitempty"`
+	NewType     string    `json:"new_type,omitempty"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+}
+
+// collectSchemaPaths records the JSON types seen at every path below value.
+// null is tracked separately so optional fields do not read as type changes.
+func collectSchemaPaths(value any, path string, types map[string]map[string]bool) {
+	if len(types) >= maxSchemaPaths {
+		return
+	}
+	if types[path] == nil {
+		types[path] = make(map[string]bool)
+	}
+
+	switch typed := value.(type) {
+	case map[string]any:
+		types[path]["object"] = true
+		for key, child := range typed {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			collectSchemaPaths(child, childPath, types)
+		}
+	case []any:
+		types[path]["array"] = true
+		for _, item := range typed {
+			collectSchemaPaths(item, path+"[]", types)
+		}
+	case string:
+		types[path]["string"] = true
+	case float64:
+		types[path]["number"] = true
+	case bool:
+		types[path]["boolean"] = true
+	case nil:
+		types[path]["null"] = true
+	}
+}
+
+// schemaTypeName joins the non-null types seen at a path; "null" only when
+// nothing else was seen.
+func schemaTypeName(seen map[string]bool) string {
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		if name != "null" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "null"
+	}
+	slices.Sort(names)
+	return strings.Join(names, "|")
+}
+
+// mergeSchemaTypes unions two type names as produced by schemaTypeName.
+func mergeSchemaTypes(a, b string) string {
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(a+"|"+b, "|") {
+		seen[name] = true
+	}
+	return schemaTypeName(seen)
+}
+
+func schemaParentPath(path string) string {
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
+
+func (s *SchemaDriftStore) loadKnown(endpoint string) (map[string]string, error) {
+	if known, ok := s.known[endpoint]; ok {
+		return known, nil
+	}
+
+	rows, err := s.db.Query(`SELECT path, json_type FROM schema_fields WHERE endpoint = ?`, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("query schema fields: %w", err)
+	}
+	defer rows.Close()
+
+	known := make(map[string]string)
+	for rows.Next() {
+		var path, jsonType string
+		if err := rows.Scan(&path, &jsonType); err != nil {
+			return nil, fmt.Errorf("scan schema fields: %w", err)
+		}
+		known[path] = jsonType
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate schema fields: %w", err)
+	}
+	s.known[endpoint] = known
+	return known, nil
+}
+
+// Observe compares one response body with the fields known for endpoint and
+// returns the drift recorded for the first time. The first response for an
+// endpoint only sets the baseline.
+func (s *SchemaDriftStore) Observe(endpoint string, body json.RawMessage, observedAt time.Time) ([]SchemaDrift, error) {
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, nil
+	}
+	seen := make(map[string]map[string]bool)
+	collectSchemaPaths(value, "", seen)
+	delete(seen, "")
+	observedAt = utcNowOr(observedAt)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	known, err := s.loadKnown(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	baseline := len(known) == 0
+	existing := maps.Clone(known)
+
+	drift := make([]SchemaDrift, 0)
+	err = withTx(s.db, func(tx *sql.Tx) error {
+		for path, types := range seen {
+			current := schemaTypeName(types)
+			previous, ok := known[path]
+			if ok && (previous == current || current == "null") {
+				continue
+			}
+			switch {
+			case !ok:
+				// Only the root of a new subtree is reported; array item
+				// shapes first seen once an empty array fills up are not new.
+				parent := schemaParentPath(path)
+				_, parentKnown := existing[parent]
+				if !baseline && !strings.HasSuffix(path, "[]") && (parent == "" || parentKnown) {
+					drift = append(drift, SchemaDrift{Endpoint: endpoint, Path: path, Change: schemaChangeAdded, NewType: current})
+				}
+			case previous != "null":
+				merged := mergeSchemaTypes(previous, current)
+				if merged == previous {
+					continue
+				}
+				drift = append(drift, SchemaDrift{Endpoint: endpoint, Path: path, Change: schemaChangeTypeChanged, OldType: previous, NewType: current})
+				current = merged
+			}
+
+			if _, err := tx.Exec(
+				`INSERT INTO schema_fields (endpoint, path, json_type, first_seen_at)
+				 VALUES (?, ?, ?, ?)
+				 ON CONFLICT(endpoint, path) DO UPDATE SET json_type = excluded.json_type`,
+				endpoint, path, current, formatTime(observedAt),
+			); err != nil {
+				return fmt.Errorf("upsert schema field %s: %w", path, err)
+			}
+			known[path] = current
+		}
+
+		// A known key counts as removed only when its parent object was
+		// present in this response but the key was not. Array items are
+		// never reported, since empty arrays are normal.
+		_, rootIsObject := value.(map[string]any)
+		for path, jsonType := range known {
+			if _, ok := seen[path]; ok || strings.HasSuffix(path, "[]") {
+				continue
+			}
+			parent := schemaParentPath(path)
+			if parent == "" && !rootIsObject {
+				continue
+			}
+			if parent != "" && !seen[parent]["object"] {
+				continue
+			}
+			drift = append(drift, SchemaDrift{Endpoint: endpoint, Path: path, Change: schemaChangeRemoved, OldType: jsonType})
+		}
+
+		recorded := drift[:0]
+		for _, change := range drift {
+			change.FirstSeenAt = observedAt
+			result, err := tx.Exec(
+				`INSERT INTO schema_drift (endpoint, path, change, old_type, new_type, first_seen_at)
+				 VALUES (?, ?, ?, ?, ?, ?)
+				 ON CONFLICT(endpoint, path, change, old_type, new_type) DO NOTHING`,
+				change.Endpoint, change.Path, change.Change, change.OldType, change.NewType, formatTime(observedAt),
+			)
+			if err != nil {
+				return fmt.Errorf("insert schema drift %s: %w", change.Path, err)
+			}
+			if affected, _ := result.RowsAffected(); affected > 0 {
+				recorded = append(recorded, change)
+			}
+		}
+		drift = recorded
+		return nil
+	})
+	if err != nil {
+		// The cache may now be ahead of the database; reload next time.
+		delete(s.known, endpoint)
+		return nil, err
+	}
+	return drift, nil
+}
+
+func (s *SchemaDriftStore) GetDrift(endpoint string, limit int) ([]SchemaDrift, error) {
+	limit = clamp(limit, defaultSchemaDriftLimit, maxSchemaDriftLimit)
+
+	rows, err := s.db.Query(
+		`SELECT endpoint, path, change, old_type, new_type, first_seen_at
+		 FROM schema_drift
+		 WHERE ? = '' OR endpoint = ?
+		 ORDER BY first_seen_at DESC, row_id DESC
+		 LIMIT ?`,
+		endpoint, endpoint, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query schema drift: %w", err)
+	}
+	defer rows.Close()
+
+	drift := make([]SchemaDrift, 0)
+	for rows.Next() {
+		var change SchemaDrift
+		var firstSeenAt string
+		if err := rows.Scan(&change.Endpoint, &change.Path, &change.Change, &change.OldType, &change.NewType, &firstSeenAt); err != nil {
+			return nil, fmt.Errorf("scan schema drift: %w", err)
+		}
+		change.FirstSeenAt = parseTime(firstSeenAt)
+		drift = append(drift, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate schema drift: %w", err)
+	}
+	return drift, nil
+}
+
+// GetFieldCounts returns how many field paths are known per endpoint.
+func (s *SchemaDriftStore) GetFieldCounts() (map[string]int, error) {
+	rows, err := s.db.Query(`SELECT endpoint, COUNT(*) FROM schema_fields GROUP BY endpoint`)
+	if err != nil {
+		return nil, fmt.Errorf("query schema field counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var endpoint string
+		var count int
+		if err := rows.Scan(&endpoint, &count); err != nil {
+			return nil, fmt.Errorf("scan schema field counts: %w", err)
+		}
+		counts[endpoint] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate schema field counts: %w", err)
+	}
+	return counts, nil
+}
+
+func (s *Service) observeSchema(endpoint string, payload interceptedResponsePayload) {
+	if s.schemaDriftStore == nil || len(payload.Body) == 0 {
+		return
+	}
+	if payload.StatusCode != 0 && payload.StatusCode != http.StatusOK {
+		return
+	}
+
+	drift, err := s.schemaDriftStore.Observe(endpoint, payload.Body, payload.ObservedAt)
+	if err != nil {
+		logWarn("schema.observe_failed", "endpoint", endpoint, "error", err)
+		return
+	}
+	for _, change := range drift {
+		logWarn("schema.drift", "endpoint", endpoint, "path", change.Path, "change", change.Change, "old_type", change.OldType, "new_type", change.NewType)
+	}
+}
+
+func (s *Service) handleDebugSchemaDrift(w http.ResponseWriter, r *http.Request) {
+	if s.schemaDriftStore == nil {
+		writeError(w, http.StatusServiceUnavailable, "schema drift store not configured", nil)
+		return
+	}
+
+	limit, err := parseIntQuery(r, "limit", defaultSchemaDriftLimit, 1, maxSchemaDriftLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	endpoint := strings.TrimSpace(r.URL.Query().Get("endpoint"))
+
+	drift, err := s.schemaDriftStore.GetDrift(endpoint, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load schema drift", nil)
+		return
+	}
+	fields, err := s.schemaDriftStore.GetFieldCounts()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load schema fields", nil)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"results": drift,
+		"fields":  fields,
+		"meta": map[string]any{
+			"count": len(drift),
+		},
+	})
+}
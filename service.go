@@ -4,48 +4,108 @@ import (
 	"encoding/json"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Service struct {
+	config serviceConfig
+
 	studiesStore     *StudiesStore
 	submissionsStore *SubmissionsStore
 	stateStore       *ServiceStateStore
+	analyticsStore   *AnalyticsStore
+	balancesStore    *BalancesStore
+	capturesStore    *CapturesStore
+	schemaDriftStore *SchemaDriftStore
+
+	interceptRoutes []interceptRoute
+
+	studiesSessionMu sync.Mutex
+	studiesSession   *studiesRefreshSession
+
+	studiesPagination studiesPaginationHealth
+	studiesQuarantine studiesQuarantine
+	ingestRejections  ingestRejections
+	dedupe            *dedupeCache
 
 	wsClientsMu  sync.Mutex
 	wsClientsSet map[*wsConnClient]struct{}
+	wsHandshakes wsHandshakes
 
-	extensionDebugStateMu   sync.Mutex
-	extensionDebugState     json.RawMessage
-	extensionDebugStateAt   time.Time
+	refreshLeadership refreshLeadership
+
+	wsEventsStore *WSEventsStore
+	wsBroadcastMu sync.Mutex
+	tokensStore   *TokensStore
+	// wsSlowDisconnects counts clients closed by the disconnect policy.
+	wsSlowDisconnects atomic.Int64
+
+	extensionDebugStateMu sync.Mutex
+	extensionDebugState   json.RawMessage
+	extensionDebugStateAt time.Time
 }
 
 func NewService(
+	config serviceConfig,
 	studiesStore *StudiesStore,
 	submissionsStore *SubmissionsStore,
 	stateStore *ServiceStateStore,
+	analyticsStore *AnalyticsStore,
+	balancesStore *BalancesStore,
+	capturesStore *CapturesStore,
+	schemaDriftStore *SchemaDriftStore,
+	wsEventsStore *WSEventsStore,
+	tokensStore *TokensStore,
 ) *Service {
-	return &Service{
+	s := &Service{
+		config:           config,
 		studiesStore:     studiesStore,
 		submissionsStore: submissionsStore,
 		stateStore:       stateStore,
+		analyticsStore:   analyticsStore,
+		balancesStore:    balancesStore,
+		capturesStore:    capturesStore,
+		schemaDriftStore: schemaDriftStore,
+		wsEventsStore:    wsEventsStore,
+		tokensStore:      tokensStore,
 		wsClientsSet:     make(map[*wsConnClient]struct{}),
+		dedupe:           newDedupeCache(config.DedupeWindow),
 	}
+	s.registerInterceptRoutes()
+	return s
 }
 
 func (s *Service) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/", s.handleHome)
 	mux.HandleFunc("/healthz", s.handleHealthz)
-	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/status", s.requireToken(s.handleStatus))
+	s.registerRoute(mux, "/pair", http.MethodPost, s.handlePair)
 	s.registerExtensionRoute(mux, "/studies-refresh", http.MethodGet, s.handleStudiesRefresh)
 	s.registerExtensionRoute(mux, "/ws", http.MethodGet, s.handleExtensionWebSocket)
 	s.registerExtensionRoute(mux, "/study-events", http.MethodGet, s.handleStudyEvents)
 	s.registerExtensionRoute(mux, "/studies", http.MethodGet, s.handleStudies)
+	s.registerExtensionRoute(mux, "/studies/{id}", http.MethodGet, s.handleStudy)
 	s.registerExtensionRoute(mux, "/submissions", http.MethodGet, s.handleSubmissions)
+	s.registerExtensionRoute(mux, "/balance", http.MethodGet, s.handleBalance)
+	s.registerExtensionRoute(mux, "/balance/history", http.MethodGet, s.handleBalanceHistory)
 	s.registerExtensionRoute(mux, "/debug/extension-state", http.MethodGet, s.handleDebugExtensionState)
+	s.registerExtensionRoute(mux, "/debug/schema-drift", http.MethodGet, s.handleDebugSchemaDrift)
+	s.registerExtensionRoute(mux, "/debug/ingest-rejections", http.MethodGet, s.handleDebugIngestRejections)
+	s.registerExtensionRoute(mux, "/debug/clients", http.MethodGet, s.handleDebugClients)
+	s.registerExtensionRoute(mux, "/analytics/effective-rate", http.MethodGet, s.handleAnalyticsEffectiveRate)
+	s.registerExtensionRoute(mux, "/analytics/missed", http.MethodGet, s.handleAnalyticsMissed)
+	s.registerExtensionRoute(mux, "/reports/daily", http.MethodGet, s.handleDailyReport)
+	s.registerIngestRoutes(mux)
 }
 
+// registerExtensionRoute registers a CORS-enabled route that requires an API
+// token.
 func (s *Service) registerExtensionRoute(mux *http.ServeMux, path, method string, handler http.HandlerFunc) {
+	s.registerRoute(mux, path, method, s.requireToken(handler))
+}
+
+func (s *Service) registerRoute(mux *http.ServeMux, path, method string, handler http.HandlerFunc) {
 	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
 		setExtensionCORSHeaders(w)
 		if r.Method == http.MethodOptions {
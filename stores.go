@@ -1,9 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"sort"
 	"strings"
 	"time"
@@ -18,6 +20,29 @@ const (
 	maxCurrentSubmissions     = 2000
 )
 
+var availabilityEventTypes = []string{"available", "unavailable", "updated", "reopened"}
+
+// trackedStudyFields lists the normalizedStudy JSON fields whose change on a
+// still-listed study is recorded as an 'updated' event. places_taken and
+// places_available are left out: they move on every refresh while a study
+// fills up and would drown out the changes worth alerting on.
+var trackedStudyFields = []string{
+	"name",
+	"study_type",
+	"reward",
+	"average_reward_per_hour",
+	"estimated_completion_time",
+	"maximum_allowed_time",
+	"total_available_places",
+	"max_submissions_per_participant",
+	"description",
+	"device_compatibility",
+	"peripheral_requirements",
+	"study_labels",
+	"is_ongoing_study",
+	"pii_enabled",
+}
+
 var submissionStatusPhase = map[string]string{
 	"RESERVED":        SubmissionPhaseSubmitting,
 	"ACTIVE":          SubmissionPhaseSubmitting,
@@ -46,28 +71,49 @@ func (s *ServiceStateStore) SetStudiesRefresh(update StudiesRefreshUpdate) error
 
 	const maxBusyRetries = 5
 	for attempt := 0; attempt <= maxBusyRetries; attempt++ {
-		_, err := s.db.Exec(
-			`INSERT INTO service_state (
-				id,
-				last_studies_refresh_at,
-				last_studies_refresh_source,
-				last_studies_refresh_url,
-				last_studies_refresh_status,
-				updated_at
+		err := withTx(s.db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(
+				`INSERT INTO service_state (
+					id,
+					last_studies_refresh_at,
+					last_studies_refresh_source,
+					last_studies_refresh_url,
+					last_studies_refresh_status,
+					updated_at
+				)
+				VALUES (1, ?, ?, ?, ?, ?)
+				ON CONFLICT(id) DO UPDATE SET
+					last_studies_refresh_at = excluded.last_studies_refresh_at,
+					last_studies_refresh_source = excluded.last_studies_refresh_source,
+					last_studies_refresh_url = excluded.last_studies_refresh_url,
+					last_studies_refresh_status = excluded.last_studies_refresh_status,
+					updated_at = excluded.updated_at`,
+				formatTime(observedAt),
+				update.Source,
+				update.URL,
+				update.StatusCode,
+				formatTime(updatedAt),
+			); err != nil {
+				return err
+			}
+			// The missed-study analysis counts logged refreshes as coverage;
+			// a quarantined listing did not show what was really open.
+			if !update.Quarantined {
+				if _, err := tx.Exec(
+					`INSERT INTO studies_refresh_log (observed_at, source, status_code) VALUES (?, ?, ?)`,
+					formatTime(observedAt),
+					update.Source,
+					update.StatusCode,
+				); err != nil {
+					return err
+				}
+			}
+			_, err := tx.Exec(
+				`DELETE FROM studies_refresh_log WHERE observed_at < ?`,
+				formatTime(observedAt.Add(-refreshLogRetention)),
 			)
-			VALUES (1, ?, ?, ?, ?, ?)
-			ON CONFLICT(id) DO UPDATE SET
-				last_studies_refresh_at = excluded.last_studies_refresh_at,
-				last_studies_refresh_source = excluded.last_studies_refresh_source,
-				last_studies_refresh_url = excluded.last_studies_refresh_url,
-				last_studies_refresh_status = excluded.last_studies_refresh_status,
-				updated_at = excluded.updated_at`,
-			formatTime(observedAt),
-			update.Source,
-			update.URL,
-			update.StatusCode,
-			formatTime(updatedAt),
-		)
+			return err
+		})
 		if err == nil {
 			return nil
 		}
@@ -154,15 +200,58 @@ func normalizedSubmissionPhase(status string) string {
 	return SubmissionPhaseSubmitting
 }
 
+// SubmissionWrite is one snapshot to upsert and when it was observed.
+type SubmissionWrite struct {
+	Snapshot   SubmissionSnapshot
+	ObservedAt time.Time
+}
+
 func (s *SubmissionsStore) UpsertSnapshot(snapshot SubmissionSnapshot, observedAt time.Time) (*SubmissionUpdateResult, error) {
+	results, err := s.UpsertSnapshots([]SubmissionWrite{{Snapshot: snapshot, ObservedAt: observedAt}})
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// UpsertSnapshots applies the writes in order in one transaction and returns
+// a result per write. Nothing is stored if any write fails.
+func (s *SubmissionsStore) UpsertSnapshots(writes []SubmissionWrite) ([]*SubmissionUpdateResult, error) {
+	snapshots := make([]SubmissionSnapshot, len(writes))
+	for index, write := range writes {
+		snapshot, err := prepareSubmissionSnapshot(write.Snapshot)
+		if err != nil {
+			return nil, err
+		}
+		snapshots[index] = snapshot
+	}
+
+	results := make([]*SubmissionUpdateResult, len(writes))
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		for index, snapshot := range snapshots {
+			result, err := upsertSubmissionSnapshot(tx, snapshot, utcNowOr(writes[index].ObservedAt))
+			if err != nil {
+				return err
+			}
+			results[index] = result
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func prepareSubmissionSnapshot(snapshot SubmissionSnapshot) (SubmissionSnapshot, error) {
 	if strings.TrimSpace(snapshot.SubmissionID) == "" {
-		return nil, fmt.Errorf("missing submission_id")
+		return snapshot, fmt.Errorf("missing submission_id")
 	}
 
 	snapshot.SubmissionID = strings.TrimSpace(snapshot.SubmissionID)
 	snapshot.Status = canonicalSubmissionStatus(snapshot.Status)
 	if snapshot.Status == "" {
-		return nil, fmt.Errorf("missing status")
+		return snapshot, fmt.Errorf("missing status")
 	}
 
 	snapshot.Phase = normalizedSubmissionPhase(snapshot.Status)
@@ -178,8 +267,13 @@ func (s *SubmissionsStore) UpsertSnapshot(snapshot SubmissionSnapshot, observedA
 	if len(snapshot.Payload) == 0 {
 		snapshot.Payload = json.RawMessage(`{}`)
 	}
-	observedAt = utcNowOr(observedAt)
+	return snapshot, nil
+}
 
+// upsertSubmissionSnapshot writes one prepared snapshot. approved_at is set
+// only when we watch a known submission turn APPROVED; a submission first
+// seen already approved has no observed approval time.
+func upsertSubmissionSnapshot(tx *sql.Tx, snapshot SubmissionSnapshot, observedAt time.Time) (*SubmissionUpdateResult, error) {
 	result := &SubmissionUpdateResult{
 		SubmissionID: snapshot.SubmissionID,
 		StudyID:      snapshot.StudyID,
@@ -193,63 +287,72 @@ func (s *SubmissionsStore) UpsertSnapshot(snapshot SubmissionSnapshot, observedA
 	at := formatTime(observedAt)
 	updatedAt := formatTime(time.Now().UTC())
 
-	err := withTx(s.db, func(tx *sql.Tx) error {
-		if _, err := tx.Exec(
-			`INSERT INTO submissions (
-				submission_id, study_id, study_name, participant_id, status, phase, payload_json, observed_at, updated_at
-			)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-			ON CONFLICT(submission_id) DO UPDATE SET
-				study_id = CASE
-					WHEN excluded.study_id <> '' AND excluded.study_id <> 'unknown' THEN excluded.study_id
-					ELSE submissions.study_id
-				END,
-				study_name = CASE
-					WHEN excluded.study_name <> '' AND excluded.study_name <> 'Unknown Study' THEN excluded.study_name
-					ELSE submissions.study_name
-				END,
-				participant_id = CASE
-					WHEN excluded.participant_id <> '' THEN excluded.participant_id
-					ELSE submissions.participant_id
-				END,
-				status = excluded.status,
-				phase = excluded.phase,
-				payload_json = CASE
-					WHEN submissions.phase = excluded.phase
-						AND submissions.phase = 'submitted'
-						AND (
-							json_extract(submissions.payload_json, '$.returned_at') IS NOT NULL
-							OR json_extract(submissions.payload_json, '$.completed_at') IS NOT NULL
-						)
-						AND json_extract(excluded.payload_json, '$.returned_at') IS NULL
-						AND json_extract(excluded.payload_json, '$.completed_at') IS NULL
-					THEN submissions.payload_json
-					ELSE excluded.payload_json
-				END,
-				observed_at = CASE
-					WHEN submissions.phase = excluded.phase
-						AND submissions.phase = 'submitted'
-					THEN submissions.observed_at
-					ELSE excluded.observed_at
-				END,
-				updated_at = excluded.updated_at`,
-			snapshot.SubmissionID,
-			snapshot.StudyID,
-			snapshot.StudyName,
-			snapshot.ParticipantID,
-			snapshot.Status,
-			snapshot.Phase,
-			payload,
-			at,
-			updatedAt,
-		); err != nil {
-			return fmt.Errorf("upsert current submission: %w", err)
-		}
-
-		return nil
-	})
-	if err != nil {
-		return nil, err
+	var previousStatus string
+	err := tx.QueryRow(`SELECT status FROM submissions WHERE submission_id = ?`, snapshot.SubmissionID).Scan(&previousStatus)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("load current submission status: %w", err)
+	}
+	// A first sighting is not a change; otherwise the first sync of the
+	// submissions list would look like every submission just moved.
+	result.PreviousStatus = previousStatus
+	result.StatusChanged = err == nil && previousStatus != snapshot.Status
+	result.FirstSeen = err == sql.ErrNoRows
+
+	if _, err := tx.Exec(
+		`INSERT INTO submissions (
+			submission_id, study_id, study_name, participant_id, status, phase, payload_json, observed_at, updated_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(submission_id) DO UPDATE SET
+			study_id = CASE
+				WHEN excluded.study_id <> '' AND excluded.study_id <> 'unknown' THEN excluded.study_id
+				ELSE submissions.study_id
+			END,
+			study_name = CASE
+				WHEN excluded.study_name <> '' AND excluded.study_name <> 'Unknown Study' THEN excluded.study_name
+				ELSE submissions.study_name
+			END,
+			participant_id = CASE
+				WHEN excluded.participant_id <> '' THEN excluded.participant_id
+				ELSE submissions.participant_id
+			END,
+			status = excluded.status,
+			phase = excluded.phase,
+			payload_json = CASE
+				WHEN submissions.phase = excluded.phase
+					AND submissions.phase = 'submitted'
+					AND (
+						json_extract(submissions.payload_json, '$.returned_at') IS NOT NULL
+						OR json_extract(submissions.payload_json, '$.completed_at') IS NOT NULL
+					)
+					AND json_extract(excluded.payload_json, '$.returned_at') IS NULL
+					AND json_extract(excluded.payload_json, '$.completed_at') IS NULL
+				THEN submissions.payload_json
+				ELSE excluded.payload_json
+			END,
+			observed_at = CASE
+				WHEN submissions.phase = excluded.phase
+					AND submissions.phase = 'submitted'
+				THEN submissions.observed_at
+				ELSE excluded.observed_at
+			END,
+			updated_at = excluded.updated_at,
+			approved_at = CASE
+				WHEN excluded.status <> 'APPROVED' THEN NULL
+				WHEN submissions.status <> 'APPROVED' THEN excluded.observed_at
+				ELSE submissions.approved_at
+			END`,
+		snapshot.SubmissionID,
+		snapshot.StudyID,
+		snapshot.StudyName,
+		snapshot.ParticipantID,
+		snapshot.Status,
+		snapshot.Phase,
+		payload,
+		at,
+		updatedAt,
+	); err != nil {
+		return nil, fmt.Errorf("upsert current submission: %w", err)
 	}
 
 	return result, nil
@@ -334,70 +437,135 @@ type StudyChange struct {
 	Name    string `json:"name"`
 }
 
+type StudyFieldChange struct {
+	Field string          `json:"field"`
+	Old   json.RawMessage `json:"old"`
+	New   json.RawMessage `json:"new"`
+}
+
+type StudyUpdate struct {
+	StudyID        string             `json:"study_id"`
+	Name           string             `json:"name"`
+	Changes        []StudyFieldChange `json:"changes"`
+	RewardIncrease bool               `json:"reward_increase,omitempty"`
+}
+
+type StudyReopen struct {
+	StudyID     string `json:"study_id"`
+	Name        string `json:"name"`
+	GapSeconds  int64  `json:"gap_seconds"`
+	ReopenCount int    `json:"reopen_count"`
+	Flicker     bool   `json:"flicker,omitempty"`
+}
+
 type StudyAvailabilitySummary struct {
 	ObservedAt        time.Time     `json:"observed_at"`
 	NewlyAvailable    []StudyChange `json:"newly_available"`
+	Reopened          []StudyReopen `json:"reopened"`
 	BecameUnavailable []StudyChange `json:"became_unavailable"`
+	Updated           []StudyUpdate `json:"updated"`
+	Quarantined       bool          `json:"quarantined,omitempty"`
+}
+
+type availabilityEventDetails struct {
+	Changes     []StudyFieldChange `json:"changes,omitempty"`
+	GapSeconds  *int64             `json:"gap_seconds,omitempty"`
+	ReopenCount int                `json:"reopen_count,omitempty"`
 }
 
 type StudyAvailabilityEvent struct {
-	RowID                   int64     `json:"row_id"`
-	StudyID                 string    `json:"study_id"`
-	StudyName               string    `json:"study_name"`
-	EventType               string    `json:"event_type"`
-	ObservedAt              time.Time `json:"observed_at"`
-	Reward                  apiMoney  `json:"reward"`
-	AverageRewardPerHour    apiMoney  `json:"average_reward_per_hour"`
-	EstimatedCompletionTime int       `json:"estimated_completion_time"`
-	TotalAvailablePlaces    int       `json:"total_available_places"`
-	PlacesAvailable         int       `json:"places_available"`
-}
-
-func (s *StudiesStore) StoreNormalizedStudies(studies []normalizedStudy, observedAt time.Time) error {
-	if len(studies) == 0 {
-		return nil
-	}
-	observedAt = utcNowOr(observedAt)
+	RowID                   int64              `json:"row_id"`
+	StudyID                 string             `json:"study_id"`
+	StudyName               string             `json:"study_name"`
+	EventType               string             `json:"event_type"`
+	ObservedAt              time.Time          `json:"observed_at"`
+	Reward                  apiMoney           `json:"reward"`
+	AverageRewardPerHour    apiMoney           `json:"average_reward_per_hour"`
+	EstimatedCompletionTime int                `json:"estimated_completion_time"`
+	TotalAvailablePlaces    int                `json:"total_available_places"`
+	PlacesAvailable         int                `json:"places_available"`
+	Changes                 []StudyFieldChange `json:"changes,omitempty"`
+	GapSeconds              *int64             `json:"gap_seconds,omitempty"`
+	ReopenCount             int                `json:"reopen_count,omitempty"`
+}
 
-	return withTx(s.db, func(tx *sql.Tx) error {
-		ts := formatTime(observedAt)
-		for _, study := range studies {
-			payloadJSON, err := json.Marshal(study)
-			if err != nil {
-				return fmt.Errorf("marshal study %s: %w", study.ID, err)
+// storeNormalizedStudies records the studies in history and studies_latest.
+// It returns the tracked-field differences against the previously stored
+// payload, keyed by study ID, for studies that were already known.
+func storeNormalizedStudies(tx *sql.Tx, studies []normalizedStudy, observedAt time.Time) (map[string][]StudyFieldChange, error) {
+	fieldChanges := map[string][]StudyFieldChange{}
+	ts := formatTime(observedAt)
+	for _, study := range studies {
+		payloadJSON, err := json.Marshal(study)
+		if err != nil {
+			return nil, fmt.Errorf("marshal study %s: %w", study.ID, err)
+		}
+		payload := string(payloadJSON)
+
+		var previousJSON string
+		var previousRaw sql.NullString
+		err = tx.QueryRow(`SELECT payload_json, raw_json FROM studies_latest WHERE study_id = ?`, study.ID).Scan(&previousJSON, &previousRaw)
+		switch {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			return nil, fmt.Errorf("load studies latest for %s: %w", study.ID, err)
+		default:
+			if changes := diffStudyPayloads([]byte(previousJSON), payloadJSON); len(changes) > 0 {
+				fieldChanges[study.ID] = changes
 			}
-			payload := string(payloadJSON)
+		}
 
-			if _, err := tx.Exec(
-				`INSERT INTO studies_history (study_id, observed_at, payload_json)
-				 VALUES (?, ?, ?)`,
-				study.ID,
-				ts,
-				payload,
-			); err != nil {
-				return fmt.Errorf("insert studies history for %s: %w", study.ID, err)
-			}
+		raw := nullableJSON(study.Raw)
+		// History keeps a raw object only when it changed; Renormalize carries
+		// the last one forward.
+		historyRaw := raw
+		if previousRaw.Valid && sameJSON([]byte(previousRaw.String), study.Raw) {
+			historyRaw = nil
+		}
 
-			if _, err := tx.Exec(
-				`INSERT INTO studies_latest (study_id, name, payload_json, last_seen_at)
-				 VALUES (?, ?, ?, ?)
-				 ON CONFLICT(study_id) DO UPDATE SET
-				   name = excluded.name,
-				   payload_json = excluded.payload_json,
-				   last_seen_at = excluded.last_seen_at`,
-				study.ID,
-				study.Name,
-				payload,
-				ts,
-			); err != nil {
-				return fmt.Errorf("upsert studies latest for %s: %w", study.ID, err)
-			}
+		if _, err := tx.Exec(
+			`INSERT INTO studies_history (study_id, observed_at, payload_json, raw_json)
+			 VALUES (?, ?, ?, ?)`,
+			study.ID,
+			ts,
+			payload,
+			historyRaw,
+		); err != nil {
+			return nil, fmt.Errorf("insert studies history for %s: %w", study.ID, err)
 		}
-		return nil
-	})
+
+		if _, err := tx.Exec(
+			`INSERT INTO studies_latest (study_id, name, payload_json, last_seen_at, raw_json)
+			 VALUES (?, ?, ?, ?, ?)
+			 ON CONFLICT(study_id) DO UPDATE SET
+			   name = excluded.name,
+			   payload_json = excluded.payload_json,
+			   last_seen_at = excluded.last_seen_at,
+			   raw_json = COALESCE(excluded.raw_json, studies_latest.raw_json)`,
+			study.ID,
+			study.Name,
+			payload,
+			ts,
+			raw,
+		); err != nil {
+			return nil, fmt.Errorf("upsert studies latest for %s: %w", study.ID, err)
+		}
+	}
+	return fieldChanges, nil
 }
 
-func (s *StudiesStore) ReconcileAvailability(studies []normalizedStudy, observedAt time.Time) (*StudyAvailabilitySummary, error) {
+// RecordListing stores a studies listing and diffs it against the active
+// snapshot in one transaction. guard, when set, sees the snapshot before
+// anything is written and returns true to apply a full listing as a partial
+// one. Tracked-field changes are recorded as 'updated' events for studies
+// that stayed listed across the refresh. A partial listing only adds studies;
+// nothing is marked unavailable.
+func (s *StudiesStore) RecordListing(
+	studies []normalizedStudy,
+	observedAt time.Time,
+	partial bool,
+	guard func(active map[string]string) bool,
+) (*StudyAvailabilitySummary, error) {
 	observedAt = utcNowOr(observedAt)
 	current := currentStudyMap(studies)
 
@@ -411,7 +579,18 @@ func (s *StudiesStore) ReconcileAvailability(studies []normalizedStudy, observed
 		summary = &StudyAvailabilitySummary{
 			ObservedAt:        observedAt,
 			NewlyAvailable:    make([]StudyChange, 0),
+			Reopened:          make([]StudyReopen, 0),
 			BecameUnavailable: make([]StudyChange, 0),
+			Updated:           make([]StudyUpdate, 0),
+		}
+		if !partial && guard != nil && guard(previous) {
+			summary.Quarantined = true
+			partial = true
+		}
+
+		fieldChanges, err := storeNormalizedStudies(tx, studies, observedAt)
+		if err != nil {
+			return err
 		}
 
 		for id, name := range current {
@@ -419,14 +598,28 @@ func (s *StudiesStore) ReconcileAvailability(studies []normalizedStudy, observed
 				continue
 			}
 			change := StudyChange{StudyID: id, Name: name}
-			summary.NewlyAvailable = append(summary.NewlyAvailable, change)
-			if err := insertAvailabilityEvent(tx, change, "available", observedAt); err != nil {
+
+			unavailableAt, wasUnavailable, err := lastUnavailableAt(tx, id)
+			if err != nil {
 				return err
 			}
+			if !wasUnavailable {
+				summary.NewlyAvailable = append(summary.NewlyAvailable, change)
+				if err := insertAvailabilityEvent(tx, change, "available", observedAt); err != nil {
+					return err
+				}
+				continue
+			}
+
+			reopen, err := recordStudyReopen(tx, change, unavailableAt, observedAt)
+			if err != nil {
+				return err
+			}
+			summary.Reopened = append(summary.Reopened, *reopen)
 		}
 
 		for id, name := range previous {
-			if _, exists := current[id]; exists {
+			if _, exists := current[id]; exists || partial {
 				continue
 			}
 			change := StudyChange{StudyID: id, Name: name}
@@ -436,8 +629,27 @@ func (s *StudiesStore) ReconcileAvailability(studies []normalizedStudy, observed
 			}
 		}
 
+		for id, changes := range fieldChanges {
+			name, listed := current[id]
+			if _, wasListed := previous[id]; !listed || !wasListed || len(changes) == 0 {
+				continue
+			}
+			update := StudyUpdate{
+				StudyID:        id,
+				Name:           name,
+				Changes:        changes,
+				RewardIncrease: studyRewardIncreased(changes),
+			}
+			summary.Updated = append(summary.Updated, update)
+			if err := insertStudyUpdateEvent(tx, update, observedAt); err != nil {
+				return err
+			}
+		}
+
 		// Remove studies no longer present.
-		if len(current) == 0 {
+		if partial {
+			// An incomplete listing cannot prove anything went away.
+		} else if len(current) == 0 {
 			if _, err := tx.Exec(`DELETE FROM studies_active_snapshot`); err != nil {
 				return fmt.Errorf("clear active snapshot: %w", err)
 			}
@@ -480,9 +692,15 @@ func (s *StudiesStore) ReconcileAvailability(studies []normalizedStudy, observed
 	sort.Slice(summary.NewlyAvailable, func(i, j int) bool {
 		return summary.NewlyAvailable[i].StudyID < summary.NewlyAvailable[j].StudyID
 	})
+	sort.Slice(summary.Reopened, func(i, j int) bool {
+		return summary.Reopened[i].StudyID < summary.Reopened[j].StudyID
+	})
 	sort.Slice(summary.BecameUnavailable, func(i, j int) bool {
 		return summary.BecameUnavailable[i].StudyID < summary.BecameUnavailable[j].StudyID
 	})
+	sort.Slice(summary.Updated, func(i, j int) bool {
+		return summary.Updated[i].StudyID < summary.Updated[j].StudyID
+	})
 	return summary, nil
 }
 
@@ -490,7 +708,7 @@ func (s *StudiesStore) GetRecentAvailabilityEvents(limit int) ([]StudyAvailabili
 	limit = clamp(limit, defaultRecentEventsLimit, maxRecentEventsLimit)
 
 	rows, err := s.db.Query(
-		`SELECT e.row_id, e.study_id, e.study_name, e.event_type, e.observed_at, l.payload_json
+		`SELECT e.row_id, e.study_id, e.study_name, e.event_type, e.observed_at, e.details_json, l.payload_json
 		 FROM study_availability_events e
 		 LEFT JOIN studies_latest l ON l.study_id = e.study_id
 		 ORDER BY row_id DESC
@@ -506,12 +724,22 @@ func (s *StudiesStore) GetRecentAvailabilityEvents(limit int) ([]StudyAvailabili
 	for rows.Next() {
 		var event StudyAvailabilityEvent
 		var observedAt string
+		var detailsJSON sql.NullString
 		var payloadJSON sql.NullString
-		if err := rows.Scan(&event.RowID, &event.StudyID, &event.StudyName, &event.EventType, &observedAt, &payloadJSON); err != nil {
+		if err := rows.Scan(&event.RowID, &event.StudyID, &event.StudyName, &event.EventType, &observedAt, &detailsJSON, &payloadJSON); err != nil {
 			return nil, fmt.Errorf("scan availability event: %w", err)
 		}
 		event.ObservedAt = parseTime(observedAt)
 
+		if detailsJSON.Valid && detailsJSON.String != "" {
+			var details availabilityEventDetails
+			if err := json.Unmarshal([]byte(detailsJSON.String), &details); err == nil {
+				event.Changes = details.Changes
+				event.GapSeconds = details.GapSeconds
+				event.ReopenCount = details.ReopenCount
+			}
+		}
+
 		if payloadJSON.Valid && payloadJSON.String != "" {
 			var study normalizedStudy
 			if err := json.Unmarshal([]byte(payloadJSON.String), &study); err == nil {
@@ -535,7 +763,7 @@ func (s *StudiesStore) GetCurrentAvailableStudies(limit int) ([]normalizedStudy,
 	limit = clamp(limit, defaultCurrentStudies, maxCurrentStudies)
 
 	rows, err := s.db.Query(
-		`SELECT l.payload_json, a.first_seen_at
+		`SELECT l.payload_json, a.first_seen_at, l.reopen_count
 		 FROM studies_active_snapshot a
 		 JOIN studies_latest l ON l.study_id = a.study_id
 		 ORDER BY
@@ -555,7 +783,8 @@ func (s *StudiesStore) GetCurrentAvailableStudies(limit int) ([]normalizedStudy,
 	for rows.Next() {
 		var payloadJSON string
 		var firstSeenAt string
-		if err := rows.Scan(&payloadJSON, &firstSeenAt); err != nil {
+		var reopenCount int
+		if err := rows.Scan(&payloadJSON, &firstSeenAt, &reopenCount); err != nil {
 			return nil, fmt.Errorf("scan current available study: %w", err)
 		}
 
@@ -564,6 +793,7 @@ func (s *StudiesStore) GetCurrentAvailableStudies(limit int) ([]normalizedStudy,
 			return nil, fmt.Errorf("parse current available study payload: %w", err)
 		}
 		study.FirstSeenAt = firstSeenAt
+		study.ReopenCount = reopenCount
 		studies = append(studies, study)
 	}
 	if err := rows.Err(); err != nil {
@@ -572,6 +802,197 @@ func (s *StudiesStore) GetCurrentAvailableStudies(limit int) ([]normalizedStudy,
 	return studies, nil
 }
 
+// StudyDetailView is a study as last listed, plus its detail response when
+// one was captured. A study only seen on its detail page has no LastSeenAt.
+type StudyDetailView struct {
+	normalizedStudy
+	Active     bool            `json:"active"`
+	LastSeenAt *time.Time      `json:"last_seen_at,omitempty"`
+	Enrichment json.RawMessage `json:"enrichment,omitempty"`
+	EnrichedAt *time.Time      `json:"enriched_at,omitempty"`
+}
+
+// StoreStudyEnrichment keeps a study-detail response in study_enrichment,
+// apart from the listing tables, so that opening a study's page never makes
+// it look listed.
+func (s *StudiesStore) StoreStudyEnrichment(study normalizedStudy, detail json.RawMessage, observedAt time.Time) error {
+	observedAt = utcNowOr(observedAt)
+	payloadJSON, err := json.Marshal(study)
+	if err != nil {
+		return fmt.Errorf("marshal study %s: %w", study.ID, err)
+	}
+
+	if _, err := s.db.Exec(
+		`INSERT INTO study_enrichment (study_id, name, payload_json, detail_json, enriched_at)
+		 VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT(study_id) DO UPDATE SET
+		   name = excluded.name,
+		   payload_json = excluded.payload_json,
+		   detail_json = excluded.detail_json,
+		   enriched_at = excluded.enriched_at`,
+		study.ID,
+		study.Name,
+		string(payloadJSON),
+		string(detail),
+		formatTime(observedAt),
+	); err != nil {
+		return fmt.Errorf("store study enrichment for %s: %w", study.ID, err)
+	}
+	return nil
+}
+
+func (s *StudiesStore) GetStudy(studyID string) (*StudyDetailView, error) {
+	var (
+		payloadJSON    string
+		lastSeenAt     sql.NullString
+		reopenCount    int
+		enrichmentJSON sql.NullString
+		enrichedAt     sql.NullString
+		firstSeenAt    sql.NullString
+	)
+	// Listed studies come from studies_latest; detail-only ones fall back to
+	// the payload normalized from their detail response.
+	err := s.db.QueryRow(
+		`SELECT l.payload_json, l.last_seen_at, l.reopen_count, e.detail_json, e.enriched_at, a.first_seen_at
+		 FROM studies_latest l
+		 LEFT JOIN study_enrichment e ON e.study_id = l.study_id
+		 LEFT JOIN studies_active_snapshot a ON a.study_id = l.study_id
+		 WHERE l.study_id = ?
+		 UNION ALL
+		 SELECT e.payload_json, NULL, 0, e.detail_json, e.enriched_at, NULL
+		 FROM study_enrichment e
+		 WHERE e.study_id = ? AND NOT EXISTS (SELECT 1 FROM studies_latest l WHERE l.study_id = e.study_id)`,
+		studyID,
+		studyID,
+	).Scan(&payloadJSON, &lastSeenAt, &reopenCount, &enrichmentJSON, &enrichedAt, &firstSeenAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load study %s: %w", studyID, err)
+	}
+
+	view := &StudyDetailView{}
+	if lastSeenAt.Valid {
+		at := parseTime(lastSeenAt.String)
+		view.LastSeenAt = &at
+	}
+	if err := json.Unmarshal([]byte(payloadJSON), &view.normalizedStudy); err != nil {
+		return nil, fmt.Errorf("parse study %s payload: %w", studyID, err)
+	}
+	view.ReopenCount = reopenCount
+	if firstSeenAt.Valid {
+		view.Active = true
+		view.FirstSeenAt = firstSeenAt.String
+	}
+	if enrichmentJSON.Valid && enrichmentJSON.String != "" {
+		view.Enrichment = json.RawMessage(enrichmentJSON.String)
+	}
+	if enrichedAt.Valid && enrichedAt.String != "" {
+		at := parseTime(enrichedAt.String)
+		view.EnrichedAt = &at
+	}
+	return view, nil
+}
+
+type renormalizeCounts struct {
+	Latest     int
+	History    int
+	Enrichment int
+	Skipped    int
+}
+
+// Renormalize rebuilds payload_json from the stored raw objects with the
+// current normalizeAPIStudy, for studies_latest, study_enrichment and, with
+// history set, for every studies_history row. A history row whose raw object
+// was unchanged takes the last one stored before it. Rows stored before raw
+// capture are left alone, as are raw objects that no longer validate.
+func (s *StudiesStore) Renormalize(history bool) (renormalizeCounts, error) {
+	var counts renormalizeCounts
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		var err error
+		if counts.Latest, err = renormalizeRows(tx, "studies_latest", "study_id",
+			`SELECT study_id, raw_json FROM studies_latest WHERE raw_json IS NOT NULL`, &counts.Skipped); err != nil {
+			return err
+		}
+		if counts.Enrichment, err = renormalizeRows(tx, "study_enrichment", "study_id",
+			`SELECT study_id, detail_json FROM study_enrichment`, &counts.Skipped); err != nil {
+			return err
+		}
+		if !history {
+			return nil
+		}
+		counts.History, err = renormalizeRows(tx, "studies_history", "row_id",
+			`SELECT row_id, raw FROM (
+			   SELECT h.row_id, (
+			     SELECT p.raw_json FROM studies_history p
+			     WHERE p.study_id = h.study_id AND p.row_id <= h.row_id AND p.raw_json IS NOT NULL
+			     ORDER BY p.row_id DESC
+			     LIMIT 1
+			   ) AS raw
+			   FROM studies_history h
+			 )
+			 WHERE raw IS NOT NULL`, &counts.Skipped)
+		return err
+	})
+	if err != nil {
+		return renormalizeCounts{}, err
+	}
+	return counts, nil
+}
+
+// renormalizeRows rewrites payload_json for the (key, raw) rows query returns
+// and counts the rows it rewrote; rows whose raw object fails validation are
+// added to skipped.
+func renormalizeRows(tx *sql.Tx, table, keyColumn, query string, skipped *int) (int, error) {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return 0, fmt.Errorf("query %s raw studies: %w", table, err)
+	}
+
+	type rawRow struct {
+		key any
+		raw string
+	}
+	pending := make([]rawRow, 0)
+	for rows.Next() {
+		var row rawRow
+		if err := rows.Scan(&row.key, &row.raw); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan %s raw study: %w", table, err)
+		}
+		pending = append(pending, row)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, fmt.Errorf("iterate %s raw studies: %w", table, err)
+	}
+	rows.Close()
+
+	rewritten := 0
+	for _, row := range pending {
+		study, err := decodeAPIStudy(json.RawMessage(row.raw))
+		if err != nil {
+			logWarn("studies.renormalize.skipped", "table", table, "key", row.key, "error", err)
+			*skipped++
+			continue
+		}
+		payloadJSON, err := json.Marshal(normalizeAPIStudy(study))
+		if err != nil {
+			return 0, fmt.Errorf("marshal %s study %v: %w", table, row.key, err)
+		}
+		if _, err := tx.Exec(
+			`UPDATE `+table+` SET payload_json = ? WHERE `+keyColumn+` = ?`,
+			string(payloadJSON),
+			row.key,
+		); err != nil {
+			return 0, fmt.Errorf("update %s study %v: %w", table, row.key, err)
+		}
+		rewritten++
+	}
+	return rewritten, nil
+}
+
 func withTx(db *sql.DB, fn func(*sql.Tx) error) (err error) {
 	tx, err := db.Begin()
 	if err != nil {
@@ -635,6 +1056,170 @@ func insertAvailabilityEvent(tx *sql.Tx, change StudyChange, eventType string, o
 	return nil
 }
 
+// lastUnavailableAt reports when the study last went unavailable, provided
+// that is still its latest availability transition.
+func lastUnavailableAt(tx *sql.Tx, studyID string) (time.Time, bool, error) {
+	var eventType, observedAt string
+	err := tx.QueryRow(
+		`SELECT event_type, observed_at
+		 FROM study_availability_events
+		 WHERE study_id = ? AND event_type IN ('available', 'unavailable', 'reopened')
+		 ORDER BY row_id DESC
+		 LIMIT 1`,
+		studyID,
+	).Scan(&eventType, &observedAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("load last availability event for %s: %w", studyID, err)
+	}
+	if eventType != "unavailable" {
+		return time.Time{}, false, nil
+	}
+	return parseTime(observedAt), true, nil
+}
+
+func recordStudyReopen(tx *sql.Tx, change StudyChange, unavailableAt, observedAt time.Time) (*StudyReopen, error) {
+	reopen := &StudyReopen{
+		StudyID: change.StudyID,
+		Name:    change.Name,
+	}
+	if !unavailableAt.IsZero() && observedAt.After(unavailableAt) {
+		reopen.GapSeconds = int64(observedAt.Sub(unavailableAt) / time.Second)
+	}
+
+	err := tx.QueryRow(
+		`UPDATE studies_latest SET reopen_count = reopen_count + 1 WHERE study_id = ? RETURNING reopen_count`,
+		change.StudyID,
+	).Scan(&reopen.ReopenCount)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("bump reopen count for %s: %w", change.StudyID, err)
+	}
+
+	details, err := json.Marshal(availabilityEventDetails{
+		GapSeconds:  &reopen.GapSeconds,
+		ReopenCount: reopen.ReopenCount,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal reopened event for %s: %w", change.StudyID, err)
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO study_availability_events (study_id, study_name, event_type, observed_at, details_json)
+		 VALUES (?, ?, 'reopened', ?, ?)`,
+		change.StudyID,
+		change.Name,
+		formatTime(observedAt),
+		string(details),
+	); err != nil {
+		return nil, fmt.Errorf("insert reopened event for %s: %w", change.StudyID, err)
+	}
+	return reopen, nil
+}
+
+func insertStudyUpdateEvent(tx *sql.Tx, update StudyUpdate, observedAt time.Time) error {
+	details, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("marshal updated event for %s: %w", update.StudyID, err)
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO study_availability_events (study_id, study_name, event_type, observed_at, details_json)
+		 VALUES (?, ?, 'updated', ?, ?)`,
+		update.StudyID,
+		update.Name,
+		formatTime(observedAt),
+		string(details),
+	); err != nil {
+		return fmt.Errorf("insert updated event for %s: %w", update.StudyID, err)
+	}
+	return nil
+}
+
+func diffStudyPayloads(previous, current []byte) []StudyFieldChange {
+	var before, after map[string]json.RawMessage
+	if err := json.Unmarshal(previous, &before); err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(current, &after); err != nil {
+		return nil
+	}
+
+	changes := make([]StudyFieldChange, 0)
+	for _, field := range trackedStudyFields {
+		oldValue, newValue := before[field], after[field]
+		if jsonValuesEqual(oldValue, newValue) {
+			continue
+		}
+		changes = append(changes, StudyFieldChange{
+			Field: field,
+			Old:   nullIfEmpty(oldValue),
+			New:   nullIfEmpty(newValue),
+		})
+	}
+	return changes
+}
+
+func jsonValuesEqual(a, b json.RawMessage) bool {
+	var left, right any
+	if len(a) > 0 {
+		if err := json.Unmarshal(a, &left); err != nil {
+			return false
+		}
+	}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &right); err != nil {
+			return false
+		}
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+// nullableJSON stores raw as TEXT, or NULL when it is empty.
+func nullableJSON(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
+
+// sameJSON reports whether a and b encode the same JSON text, ignoring
+// insignificant whitespace.
+func sameJSON(a, b []byte) bool {
+	var compactA, compactB bytes.Buffer
+	if json.Compact(&compactA, a) != nil || json.Compact(&compactB, b) != nil {
+		return false
+	}
+	return bytes.Equal(compactA.Bytes(), compactB.Bytes())
+}
+
+func nullIfEmpty(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return json.RawMessage(`null`)
+	}
+	return raw
+}
+
+func studyRewardIncreased(changes []StudyFieldChange) bool {
+	for _, change := range changes {
+		if change.Field != "reward" && change.Field != "average_reward_per_hour" {
+			continue
+		}
+		var before, after apiMoney
+		if json.Unmarshal(change.Old, &before) != nil || json.Unmarshal(change.New, &after) != nil {
+			continue
+		}
+		if after.Amount > before.Amount {
+			return true
+		}
+	}
+	return false
+}
+
+// sqlPlaceholders returns "?, ?, ..." for an IN list of n values.
+func sqlPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
 func formatTime(t time.Time) string {
 	return t.UTC().Format(time.RFC3339Nano)
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// suspectRefresh describes a full studies listing that would have retired
+// most of the active studies at once.
+type suspectRefresh struct {
+	ObservedAt     time.Time `json:"observed_at"`
+	Source         string    `json:"source"`
+	URL            string    `json:"url"`
+	StatusCode     int       `json:"status_code"`
+	PreviousActive int       `json:"previous_active"`
+	Listed         int       `json:"listed"`
+	Dropped        int       `json:"dropped"`
+	DropRatio      float64   `json:"drop_ratio"`
+}
+
+type studiesQuarantineStatus struct {
+	Guard            massDropGuardConfig `json:"guard"`
+	Consecutive      int                 `json:"consecutive"`
+	TotalQuarantined int                 `json:"total_quarantined"`
+	LastQuarantined  *suspectRefresh     `json:"last_quarantined,omitempty"`
+	LastConfirmed    *suspectRefresh     `json:"last_confirmed,omitempty"`
+}
+
+type studiesQuarantine struct {
+	mu     sync.Mutex
+	status studiesQuarantineStatus
+}
+
+func (g massDropGuardConfig) enabled() bool {
+	return g.Ratio > 0 && g.Ratio <= 1
+}
+
+// inspect returns the refresh details when listing studies would drop at
+// least Ratio of a large enough active set.
+func (g massDropGuardConfig) inspect(active map[string]string, studies []normalizedStudy) *suspectRefresh {
+	if !g.enabled() || len(active) == 0 || len(active) < g.MinActive {
+		return nil
+	}
+
+	listed := currentStudyMap(studies)
+	dropped := 0
+	for id := range active {
+		if _, ok := listed[id]; !ok {
+			dropped++
+		}
+	}
+	ratio := float64(dropped) / float64(len(active))
+	if ratio < g.Ratio {
+		return nil
+	}
+	return &suspectRefresh{
+		PreviousActive: len(active),
+		Listed:         len(listed),
+		Dropped:        dropped,
+		DropRatio:      roundTo(ratio, 3),
+	}
+}
+
+// admit records the outcome of a full refresh and reports whether a suspect
+// one must be quarantined. The drop is accepted once Confirmations suspect
+// refreshes arrive in a row; any normal refresh resets the count.
+func (q *studiesQuarantine) admit(guard massDropGuardConfig, suspect *suspectRefresh) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if suspect == nil {
+		q.status.Consecutive = 0
+		return false
+	}
+
+	q.status.Consecutive++
+	if q.status.Consecutive >= guard.Confirmations {
+		q.status.Consecutive = 0
+		q.status.LastConfirmed = suspect
+		return false
+	}
+	q.status.TotalQuarantined++
+	q.status.LastQuarantined = suspect
+	return true
+}
+
+func (q *studiesQuarantine) snapshot(guard massDropGuardConfig) studiesQuarantineStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	status := q.status
+	status.Guard = guard
+	return status
+}
+
+// guardStudiesRefresh checks a full listing against the active snapshot it
+// is about to replace and returns true when it should be applied additively
+// only. It runs inside the listing's transaction.
+func (s *Service) guardStudiesRefresh(
+	active map[string]string,
+	studies []normalizedStudy,
+	observedAt time.Time,
+	source string,
+	sourceURL string,
+	statusCode int,
+) bool {
+	guard := s.config.MassDrop
+	if !guard.enabled() {
+		return false
+	}
+
+	suspect := guard.inspect(active, studies)
+	if suspect != nil {
+		suspect.ObservedAt = observedAt
+		suspect.Source = source
+		suspect.URL = sourceURL
+		suspect.StatusCode = statusCode
+	}
+	if s.studiesQuarantine.admit(guard, suspect) {
+		logWarn(
+			"studies.refresh.quarantined",
+			"source", source,
+			"url", sourceURL,
+			"previous_active", suspect.PreviousActive,
+			"listed", suspect.Listed,
+			"dropped", suspect.Dropped,
+			"drop_ratio", suspect.DropRatio,
+		)
+		return true
+	}
+	if suspect != nil {
+		logWarn("studies.refresh.mass_drop_confirmed", "source", source, "url", sourceURL, "dropped", suspect.Dropped, "previous_active", suspect.PreviousActive)
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func testActive(ids ...string) map[string]string {
+	active := make(map[string]string, len(ids))
+	for _, id := range ids {
+		active[id] = "Study " + id
+	}
+	return active
+}
+
+func TestMassDropGuardInspect(t *testing.T) {
+	guard := massDropGuardConfig{Ratio: 0.5, MinActive: 4, Confirmations: 2}
+
+	tests := []struct {
+		name    string
+		guard   massDropGuardConfig
+		active  map[string]string
+		listed  []normalizedStudy
+		dropped int
+	}{
+		{"below min active", guard, testActive("A", "B", "C"), nil, 0},
+		{"exactly min active", guard, testActive("A", "B", "C", "D"), nil, 4},
+		{"ratio at boundary", guard, testActive("A", "B", "C", "D"), testStudies("A", "B"), 2},
+		{"ratio below boundary", guard, testActive("A", "B", "C", "D"), testStudies("A", "B", "C"), 0},
+		{"new studies do not offset drops", guard, testActive("A", "B", "C", "D"), testStudies("A", "B", "E", "F"), 2},
+		{"disabled", massDropGuardConfig{MinActive: 4}, testActive("A", "B", "C", "D"), nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suspect := tt.guard.inspect(tt.active, tt.listed)
+			if tt.dropped == 0 {
+				if suspect != nil {
+					t.Fatalf("inspect = %+v, want nil", suspect)
+				}
+				return
+			}
+			if suspect == nil {
+				t.Fatal("inspect = nil, want a suspect refresh")
+			}
+			if suspect.Dropped != tt.dropped || suspect.PreviousActive != len(tt.active) {
+				t.Fatalf("inspect = %+v, want %d of %d dropped", suspect, tt.dropped, len(tt.active))
+			}
+		})
+	}
+}
+
+func TestStudiesQuarantineAdmit(t *testing.T) {
+	guard := massDropGuardConfig{Ratio: 0.5, MinActive: 4, Confirmations: 3}
+	suspect := &suspectRefresh{PreviousActive: 4, Dropped: 4, DropRatio: 1}
+	var q studiesQuarantine
+
+	for i := 1; i < guard.Confirmations; i++ {
+		if !q.admit(guard, suspect) {
+			t.Fatalf("suspect refresh %d was not quarantined", i)
+		}
+	}
+	if q.admit(guard, suspect) {
+		t.Fatal("confirming suspect refresh was quarantined")
+	}
+	status := q.snapshot(guard)
+	if status.Consecutive != 0 || status.TotalQuarantined != 2 || status.LastConfirmed != suspect {
+		t.Fatalf("status after confirmation = %+v", status)
+	}
+
+	// A normal refresh in between starts the count again.
+	if !q.admit(guard, suspect) {
+		t.Fatal("suspect refresh after confirmation was not quarantined")
+	}
+	if q.admit(guard, nil) {
+		t.Fatal("normal refresh was quarantined")
+	}
+	if status := q.snapshot(guard); status.Consecutive != 0 {
+		t.Fatalf("consecutive = %d after a normal refresh, want 0", status.Consecutive)
+	}
+	for i := 1; i < guard.Confirmations; i++ {
+		if !q.admit(guard, suspect) {
+			t.Fatalf("suspect refresh %d after reset was not quarantined", i)
+		}
+	}
+}
+
+func TestReconcileStudiesQuarantinesMassDrop(t *testing.T) {
+	s := newTestService(t)
+	s.config.MassDrop = massDropGuardConfig{Ratio: 0.5, MinActive: 2, Confirmations: 2}
+	at := time.Now().UTC()
+
+	s.reconcileStudies(testStudies("A", "B", "C"), at, "test", testStudiesURL, 200, false)
+
+	summary := s.reconcileStudies(testStudies("A"), at.Add(time.Minute), "test", testStudiesURL, 200, false)
+	if summary == nil || !summary.Quarantined || len(summary.BecameUnavailable) != 0 {
+		t.Fatalf("summary = %+v, want a quarantined refresh", summary)
+	}
+	if active := activeStudyIDs(t, s); len(active) != 3 {
+		t.Fatalf("active = %v, want A, B and C kept", active)
+	}
+	if count := refreshLogCount(t, s); count != 1 {
+		t.Fatalf("refresh log has %d entries, want the quarantined refresh left out", count)
+	}
+
+	summary = s.reconcileStudies(testStudies("A"), at.Add(2*time.Minute), "test", testStudiesURL, 200, false)
+	if summary == nil || summary.Quarantined || len(summary.BecameUnavailable) != 2 {
+		t.Fatalf("summary = %+v, want B and C retired on confirmation", summary)
+	}
+	if count := refreshLogCount(t, s); count != 2 {
+		t.Fatalf("refresh log has %d entries, want 2", count)
+	}
+}
+
+func refreshLogCount(t *testing.T, s *Service) int {
+	t.Helper()
+	var count int
+	if err := s.studiesStore.db.QueryRow(`SELECT COUNT(*) FROM studies_refresh_log`).Scan(&count); err != nil {
+		t.Fatalf("count refresh log: %v", err)
+	}
+	return count
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prolific can paginate the studies list through _links. A refresh session
+// buffers every page of one listing and reconciles availability once the full
+// set has been seen, so page 2 never retires the studies listed on page 1.
+// The extension follows _links.next itself so its refreshes complete. Pages
+// are only stored once their session is reconciled.
+var studiesPageSessionTimeout = 30 * time.Second
+
+// studiesPartialWarnAfter is how many partial refreshes in a row /status
+// tolerates before it warns that availability is no longer being tracked.
+const studiesPartialWarnAfter = 3
+
+type studiesPartialRefresh struct {
+	At             time.Time `json:"at"`
+	Reason         string    `json:"reason"`
+	URL            string    `json:"url"`
+	PagesCollected int       `json:"pages_collected"`
+	LastPage       int       `json:"last_page,omitempty"`
+}
+
+type studiesPaginationStatus struct {
+	ConsecutivePartial int                    `json:"consecutive_partial"`
+	TotalPartial       int                    `json:"total_partial"`
+	LastPartial        *studiesPartialRefresh `json:"last_partial,omitempty"`
+	LastCompleteAt     *time.Time             `json:"last_complete_at,omitempty"`
+	Warning            string                 `json:"warning,omitempty"`
+}
+
+// studiesPaginationHealth counts sessions flushed as partial. A client that
+// only ever fetches page 1 of a paginated listing never completes one, and
+// no study is then marked unavailable.
+type studiesPaginationHealth struct {
+	mu     sync.Mutex
+	status studiesPaginationStatus
+}
+
+func (h *studiesPaginationHealth) recordPartial(partial studiesPartialRefresh) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.status.ConsecutivePartial++
+	h.status.TotalPartial++
+	h.status.LastPartial = &partial
+}
+
+func (h *studiesPaginationHealth) recordComplete(at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.status.ConsecutivePartial = 0
+	h.status.LastCompleteAt = &at
+}
+
+func (h *studiesPaginationHealth) snapshot() studiesPaginationStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := h.status
+	if status.ConsecutivePartial >= studiesPartialWarnAfter {
+		status.Warning = "recent studies refreshes did not fetch every page of the listing; studies are not being marked unavailable"
+	}
+	return status
+}
+
+type studiesPage struct {
+	key       string
+	number    int
+	last      int
+	paginated bool
+}
+
+// parseStudiesPage works out where a response sits in its listing. key is the
+// listing URL without its page parameter; last is 0 while the final page is
+// still unknown.
+func parseStudiesPage(rawURL string, links apiStudiesLinks) studiesPage {
+	page := studiesPage{number: 1}
+	page.paginated = links.Next.Href != nil || links.Previous.Href != nil
+
+	if parsed, err := url.Parse(rawURL); err == nil {
+		query := parsed.Query()
+		if number, ok := studiesPageNumber(query.Get("page")); ok {
+			page.number = number
+		}
+		query.Del("page")
+		parsed.RawQuery = query.Encode()
+		page.key = parsed.String()
+	} else {
+		page.key = rawURL
+	}
+
+	switch {
+	case links.Next.Href == nil:
+		page.last = page.number
+	case links.Last.Href != nil:
+		if parsed, err := url.Parse(*links.Last.Href); err == nil {
+			if number, ok := studiesPageNumber(parsed.Query().Get("page")); ok {
+				page.last = number
+			}
+		}
+	}
+	return page
+}
+
+func studiesPageNumber(raw string) (int, bool) {
+	number, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil || number < 1 {
+		return 0, false
+	}
+	return number, true
+}
+
+type studiesRefreshSession struct {
+	key        string
+	source     string
+	url        string
+	observedAt time.Time
+	lastPage   int
+	pages      map[int][]normalizedStudy
+	incomplete bool
+	timer      *time.Timer
+}
+
+type studiesPageProgress struct {
+	Page           int  `json:"page"`
+	LastPage       int  `json:"last_page,omitempty"`
+	PagesCollected int  `json:"pages_collected"`
+	Complete       bool `json:"complete"`
+}
+
+func (sess *studiesRefreshSession) complete() bool {
+	if sess.lastPage == 0 {
+		return false
+	}
+	for number := 1; number <= sess.lastPage; number++ {
+		if _, ok := sess.pages[number]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// studies merges the collected pages in page order. A study that moved
+// between pages while the session was open is kept once.
+func (sess *studiesRefreshSession) studies() []normalizedStudy {
+	numbers := make([]int, 0, len(sess.pages))
+	for number := range sess.pages {
+		numbers = append(numbers, number)
+	}
+	slices.Sort(numbers)
+
+	seen := make(map[string]struct{})
+	merged := make([]normalizedStudy, 0)
+	for _, number := range numbers {
+		for _, study := range sess.pages[number] {
+			if _, ok := seen[study.ID]; ok {
+				continue
+			}
+			seen[study.ID] = struct{}{}
+			merged = append(merged, study)
+		}
+	}
+	return merged
+}
+
+// collectStudiesPage adds one page to the open session. It returns the session
+// when this page completed it; incomplete marks pages that dropped rejected
+// results. A session that is replaced by a new listing or
+// a restarted one is flushed as a partial refresh.
+func (s *Service) collectStudiesPage(
+	page studiesPage,
+	results []normalizedStudy,
+	observedAt time.Time,
+	source string,
+	sourceURL string,
+	incomplete bool,
+) (*studiesRefreshSession, studiesPageProgress) {
+	s.studiesSessionMu.Lock()
+
+	var stale *studiesRefreshSession
+	sess := s.studiesSession
+	if sess != nil {
+		_, seenPage := sess.pages[page.number]
+		if sess.key != page.key || seenPage {
+			stale = sess
+			stale.timer.Stop()
+			sess = nil
+		}
+	}
+	if sess == nil {
+		sess = &studiesRefreshSession{
+			key:   page.key,
+			pages: make(map[int][]normalizedStudy),
+		}
+		sess.timer = time.AfterFunc(studiesPageSessionTimeout, func() { s.expireStudiesSession(sess) })
+		s.studiesSession = sess
+	}
+
+	sess.pages[page.number] = results
+	if page.last > 0 {
+		sess.lastPage = page.last
+	}
+	sess.incomplete = sess.incomplete || incomplete
+	sess.observedAt = observedAt
+	sess.source = source
+	sess.url = sourceURL
+
+	progress := studiesPageProgress{
+		Page:           page.number,
+		LastPage:       sess.lastPage,
+		PagesCollected: len(sess.pages),
+		Complete:       sess.complete(),
+	}
+	var completed *studiesRefreshSession
+	if progress.Complete {
+		sess.timer.Stop()
+		s.studiesSession = nil
+		completed = sess
+		s.studiesPagination.recordComplete(observedAt)
+	}
+	s.studiesSessionMu.Unlock()
+
+	if stale != nil {
+		s.flushPartialStudiesSession(stale, "superseded")
+	}
+	return completed, progress
+}
+
+func (s *Service) expireStudiesSession(sess *studiesRefreshSession) {
+	s.studiesSessionMu.Lock()
+	if s.studiesSession != sess {
+		s.studiesSessionMu.Unlock()
+		return
+	}
+	s.studiesSession = nil
+	s.studiesSessionMu.Unlock()
+
+	s.flushPartialStudiesSession(sess, "timeout")
+}
+
+// flushPartialStudiesSession reconciles an incomplete session additively:
+// studies it saw are recorded, but nothing is marked unavailable because the
+// missing pages may still list them.
+func (s *Service) flushPartialStudiesSession(sess *studiesRefreshSession, reason string) {
+	logWarn(
+		"studies.pagination.incomplete",
+		"reason", reason,
+		"url", sess.key,
+		"pages_collected", len(sess.pages),
+		"last_page", sess.lastPage,
+	)
+	s.studiesPagination.recordPartial(studiesPartialRefresh{
+		At:             sess.observedAt,
+		Reason:         reason,
+		URL:            sess.key,
+		PagesCollected: len(sess.pages),
+		LastPage:       sess.lastPage,
+	})
+	s.reconcileStudies(sess.studies(), sess.observedAt, sess.source, sess.url, http.StatusOK, true)
+}
+
+// flushStudiesSession settles whatever session is still collecting pages, as
+// if it had timed out.
+func (s *Service) flushStudiesSession() {
+	s.studiesSessionMu.Lock()
+	sess := s.studiesSession
+	if sess != nil {
+		sess.timer.Stop()
+	}
+	s.studiesSessionMu.Unlock()
+
+	if sess != nil {
+		s.expireStudiesSession(sess)
+	}
+}
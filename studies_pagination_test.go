@@ -0,0 +1,158 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	db, err := openSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return NewService(
+		serviceConfig{},
+		NewStudiesStore(db),
+		NewSubmissionsStore(db),
+		NewServiceStateStore(db),
+		NewAnalyticsStore(db),
+		NewBalancesStore(db),
+		nil,
+		NewSchemaDriftStore(db),
+		NewWSEventsStore(db),
+		NewTokensStore(db),
+	)
+}
+
+func testStudies(ids ...string) []normalizedStudy {
+	studies := make([]normalizedStudy, 0, len(ids))
+	for _, id := range ids {
+		studies = append(studies, normalizedStudy{ID: id, Name: "Study " + id})
+	}
+	return studies
+}
+
+const testStudiesURL = "https://internal-api.prolific.com/api/v1/participant/studies/"
+
+func testStudiesPage(number, last int) studiesPage {
+	return studiesPage{key: testStudiesURL, number: number, last: last, paginated: true}
+}
+
+// collectTestPage feeds one page through collectStudiesPage and reconciles the
+// session when the page completed it, as ingestStudiesPayload does.
+func collectTestPage(t *testing.T, s *Service, page studiesPage, studies []normalizedStudy, at time.Time) studiesPageProgress {
+	t.Helper()
+	session, progress := s.collectStudiesPage(page, studies, at, "test", testStudiesURL, false)
+	if session != nil {
+		s.reconcileStudies(session.studies(), session.observedAt, session.source, session.url, 200, session.incomplete)
+	}
+	return progress
+}
+
+func activeStudyIDs(t *testing.T, s *Service) map[string]string {
+	t.Helper()
+	var active map[string]string
+	err := withTx(s.studiesStore.db, func(tx *sql.Tx) error {
+		var err error
+		active, err = loadActiveSnapshot(tx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("load active snapshot: %v", err)
+	}
+	return active
+}
+
+func TestCollectStudiesPageCompletesSession(t *testing.T) {
+	s := newTestService(t)
+	at := time.Now().UTC()
+
+	if progress := collectTestPage(t, s, testStudiesPage(1, 2), testStudies("A", "B"), at); progress.Complete {
+		t.Fatalf("page 1 of 2 completed the session: %+v", progress)
+	}
+	progress := collectTestPage(t, s, testStudiesPage(2, 2), testStudies("C"), at)
+	if !progress.Complete || progress.PagesCollected != 2 {
+		t.Fatalf("progress = %+v, want a complete session of 2 pages", progress)
+	}
+	if active := activeStudyIDs(t, s); len(active) != 3 {
+		t.Fatalf("active = %v, want A, B and C", active)
+	}
+
+	// A complete listing that no longer shows B retires it.
+	collectTestPage(t, s, testStudiesPage(1, 2), testStudies("A"), at.Add(time.Minute))
+	collectTestPage(t, s, testStudiesPage(2, 2), testStudies("C"), at.Add(time.Minute))
+	if _, ok := activeStudyIDs(t, s)["B"]; ok {
+		t.Fatal("B is still active after a complete listing without it")
+	}
+}
+
+func TestCollectStudiesPageFlushesSupersededSession(t *testing.T) {
+	s := newTestService(t)
+	at := time.Now().UTC()
+
+	collectTestPage(t, s, testStudiesPage(1, 2), testStudies("A", "B"), at)
+	collectTestPage(t, s, testStudiesPage(2, 2), testStudies("C"), at)
+
+	// Page 1 arrives twice, so the first session never sees page 2.
+	collectTestPage(t, s, testStudiesPage(1, 2), testStudies("A", "D"), at.Add(time.Minute))
+	progress := collectTestPage(t, s, testStudiesPage(1, 2), testStudies("A", "D"), at.Add(2*time.Minute))
+	if progress.Complete || progress.PagesCollected != 1 {
+		t.Fatalf("progress = %+v, want a new session holding page 1", progress)
+	}
+
+	active := activeStudyIDs(t, s)
+	for _, id := range []string{"A", "B", "C", "D"} {
+		if _, ok := active[id]; !ok {
+			t.Errorf("%s is not active after a partial flush; active = %v", id, active)
+		}
+	}
+
+	status := s.studiesPagination.snapshot()
+	if status.TotalPartial != 1 || status.LastPartial == nil || status.LastPartial.Reason != "superseded" {
+		t.Fatalf("pagination status = %+v, want one superseded partial", status)
+	}
+	s.flushStudiesSession()
+}
+
+func TestCollectStudiesPageFlushesTimedOutSession(t *testing.T) {
+	previous := studiesPageSessionTimeout
+	studiesPageSessionTimeout = 20 * time.Millisecond
+	t.Cleanup(func() { studiesPageSessionTimeout = previous })
+
+	s := newTestService(t)
+	at := time.Now().UTC()
+
+	collectTestPage(t, s, testStudiesPage(1, 2), testStudies("A", "B"), at)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for s.studiesPagination.snapshot().TotalPartial == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("session did not time out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	status := s.studiesPagination.snapshot()
+	if status.LastPartial == nil || status.LastPartial.Reason != "timeout" || status.LastPartial.PagesCollected != 1 {
+		t.Fatalf("pagination status = %+v, want one timed out partial with 1 page", status)
+	}
+	// The flush reconciles after recording the partial, so wait for it.
+	for len(activeStudyIDs(t, s)) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("active = %v, want A and B recorded additively", activeStudyIDs(t, s))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.studiesSessionMu.Lock()
+	open := s.studiesSession
+	s.studiesSessionMu.Unlock()
+	if open != nil {
+		t.Fatal("timed out session is still open")
+	}
+}
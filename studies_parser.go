@@ -64,9 +64,11 @@ type apiStudy struct {
 	PreviousSubmissionCount        int                  `json:"previous_submission_count"`
 }
 
+// apiStudiesResponse keeps each result raw so the original study object can
+// be stored next to its normalized form.
 type apiStudiesResponse struct {
-	Results []apiStudy      `json:"results"`
-	Links   apiStudiesLinks `json:"_links"`
+	Results []json.RawMessage `json:"results"`
+	Links   apiStudiesLinks   `json:"_links"`
 }
 
 type normalizedResearcher struct {
@@ -102,10 +104,19 @@ type normalizedStudy struct {
 	AIInferredStudyLabels          []string             `json:"ai_inferred_study_labels"`
 	PreviousSubmissionCount        int                  `json:"previous_submission_count"`
 	FirstSeenAt                    string               `json:"first_seen_at,omitempty"`
+	ReopenCount                    int                  `json:"reopen_count,omitempty"`
+
+	// Raw is the study object exactly as Prolific sent it.
+	Raw json.RawMessage `json:"-"`
 }
 
 type normalizedStudiesResponse struct {
 	Results []normalizedStudy `json:"results"`
+	Links   apiStudiesLinks   `json:"-"`
+	// Rejected lists the results that were dropped. Invalid counts those
+	// that failed to decode or validate; the rest repeated an earlier ID.
+	Rejected []rejectedItem `json:"-"`
+	Invalid  int            `json:"-"`
 }
 
 func normalizeStudiesResponse(body []byte) (*normalizedStudiesResponse, error) {
@@ -129,56 +140,85 @@ func normalizeStudiesResponse(body []byte) (*normalizedStudiesResponse, error) {
 	}
 
 	results := make([]normalizedStudy, 0, len(raw.Results))
-	for _, study := range raw.Results {
-		placesAvailable := study.TotalAvailablePlaces - study.PlacesTaken
-		if placesAvailable < 0 {
-			placesAvailable = 0
+	rejected := make([]rejectedItem, 0)
+	invalid := 0
+	seen := make(map[string]struct{}, len(raw.Results))
+	for index, rawStudy := range raw.Results {
+		var study apiStudy
+		if err := decodeItem(rawStudy, &study); err != nil {
+			rejected = append(rejected, rejectItem(index, itemID(rawStudy), err))
+			invalid++
+			continue
+		}
+		if err := validateAPIStudy(study); err != nil {
+			rejected = append(rejected, rejectItem(index, study.ID, err))
+			invalid++
+			continue
 		}
+		if _, duplicate := seen[study.ID]; duplicate {
+			rejected = append(rejected, rejectItem(index, study.ID, invalidField("id", "duplicate in response")))
+			continue
+		}
+		seen[study.ID] = struct{}{}
 
-		results = append(results, normalizedStudy{
-			ID:          study.ID,
-			Name:        study.Name,
-			StudyType:   study.StudyType,
-			DateCreated: study.DateCreated,
-			PublishedAt: study.PublishedAt,
-
-			TotalAvailablePlaces: study.TotalAvailablePlaces,
-			PlacesTaken:          study.PlacesTaken,
-			PlacesAvailable:      placesAvailable,
-
-			Reward:               study.StudyReward,
-			AverageRewardPerHour: study.StudyAverageRewardPerHour,
-
-			MaxSubmissionsPerParticipant: study.SubmissionsConfig.MaxSubmissionsPerParticipant,
-
-			Researcher: normalizedResearcher{
-				ID:      study.Researcher.ID,
-				Name:    study.Researcher.Name,
-				Country: study.Researcher.Country,
-			},
-
-			Description:                    study.Description,
-			EstimatedCompletionTime:        study.EstimatedCompletionTime,
-			DeviceCompatibility:            study.DeviceCompatibility,
-			PeripheralRequirements:         study.PeripheralRequirements,
-			MaximumAllowedTime:             study.MaximumAllowedTime,
-			AverageCompletionTimeInSeconds: study.AverageCompletionTimeInSeconds,
-
-			IsConfidential:      study.IsConfidential,
-			IsOngoingStudy:      study.IsOngoingStudy,
-			SubmissionStartedAt: study.SubmissionStartedAt,
-			PIIEnabled:          study.PII.Enabled,
-
-			StudyLabels:           study.StudyLabels,
-			AIInferredStudyLabels: study.AIInferredStudyLabels,
-
-			PreviousSubmissionCount: study.PreviousSubmissionCount,
-		})
+		normalized := normalizeAPIStudy(study)
+		normalized.Raw = rawStudy
+		results = append(results, normalized)
 	}
 
 	normalized := normalizedStudiesResponse{
-		Results: results,
+		Results:  results,
+		Links:    raw.Links,
+		Rejected: rejected,
+		Invalid:  invalid,
 	}
 
 	return &normalized, nil
 }
+
+func normalizeAPIStudy(study apiStudy) normalizedStudy {
+	placesAvailable := study.TotalAvailablePlaces - study.PlacesTaken
+	if placesAvailable < 0 {
+		placesAvailable = 0
+	}
+
+	return normalizedStudy{
+		ID:          study.ID,
+		Name:        study.Name,
+		StudyType:   study.StudyType,
+		DateCreated: study.DateCreated,
+		PublishedAt: study.PublishedAt,
+
+		TotalAvailablePlaces: study.TotalAvailablePlaces,
+		PlacesTaken:          study.PlacesTaken,
+		PlacesAvailable:      placesAvailable,
+
+		Reward:               study.StudyReward,
+		AverageRewardPerHour: study.StudyAverageRewardPerHour,
+
+		MaxSubmissionsPerParticipant: study.SubmissionsConfig.MaxSubmissionsPerParticipant,
+
+		Researcher: normalizedResearcher{
+			ID:      study.Researcher.ID,
+			Name:    study.Researcher.Name,
+			Country: study.Researcher.Country,
+		},
+
+		Description:                    study.Description,
+		EstimatedCompletionTime:        study.EstimatedCompletionTime,
+		DeviceCompatibility:            study.DeviceCompatibility,
+		PeripheralRequirements:         study.PeripheralRequirements,
+		MaximumAllowedTime:             study.MaximumAllowedTime,
+		AverageCompletionTimeInSeconds: study.AverageCompletionTimeInSeconds,
+
+		IsConfidential:      study.IsConfidential,
+		IsOngoingStudy:      study.IsOngoingStudy,
+		SubmissionStartedAt: study.SubmissionStartedAt,
+		PIIEnabled:          study.PII.Enabled,
+
+		StudyLabels:           study.StudyLabels,
+		AIInferredStudyLabels: study.AIInferredStudyLabels,
+
+		PreviousSubmissionCount: study.PreviousSubmissionCount,
+	}
+}
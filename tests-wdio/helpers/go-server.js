@@ -8,6 +8,8 @@ export class GoServerManager {
   constructor() {
     this.process = null;
     this.url = GO_SERVER_URL;
+    // Most specs run with auth off; the pairing spec turns it on and restarts.
+    this.auth = false;
   }
 
   build() {
@@ -21,6 +23,7 @@ export class GoServerManager {
     if (this.process && this.process.exitCode === null) return;
     this.process = spawn(BINARY_PATH, [], {
       cwd: PROJECT_ROOT,
+      env: { ...process.env, PROLIFIC_PULSE_AUTH: this.auth ? 'true' : 'false' },
       stdio: 'ignore',
       detached: false,
     });
@@ -29,6 +32,20 @@ export class GoServerManager {
     });
   }
 
+  /**
+   * Create a one-time pairing code with the token CLI. The server only logs
+   * one at startup while no token exists, so specs cannot rely on that.
+   */
+  createPairingCode() {
+    const output = execSync(`"${BINARY_PATH}" token pair`, {
+      cwd: PROJECT_ROOT,
+      encoding: 'utf8',
+    });
+    const match = output.match(/pairing code ([A-Z0-9]{4}-[A-Z0-9]{4})/);
+    if (!match) throw new Error(`No pairing code in: ${output}`);
+    return match[1];
+  }
+
   async stop() {
     if (!this.process) return;
     const proc = this.process;
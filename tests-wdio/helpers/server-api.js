@@ -8,14 +8,29 @@ export async function getServerHealth() {
   return resp.json();
 }
 
-export async function getServerStatus() {
+export async function getServerStatus(token = '') {
   const resp = await fetch(`${GO_SERVER_URL}/status`, {
+    headers: token ? { Authorization: `Bearer ${token}` } : {},
     signal: AbortSignal.timeout(5000),
   });
   if (!resp.ok) throw new Error(`status returned ${resp.status}`);
   return resp.json();
 }
 
+/**
+ * Exchange a pairing code for an API token.
+ */
+export async function pairServer(code, name = 'wdio') {
+  const resp = await fetch(`${GO_SERVER_URL}/pair`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ code, name }),
+    signal: AbortSignal.timeout(5000),
+  });
+  if (!resp.ok) throw new Error(`pair returned ${resp.status}`);
+  return (await resp.json()).token;
+}
+
 export async function getServerStudies(limit = 200) {
   const resp = await fetch(`${GO_SERVER_URL}/studies?limit=${limit}`, {
     signal: AbortSignal.timeout(5000),
@@ -39,3 +54,33 @@ export async function getDebugExtensionState(raw = false) {
   if (data.has_state) return data.state || {};
   return {};
 }
+
+export async function getServerBalance() {
+  const resp = await fetch(`${GO_SERVER_URL}/balance`, {
+    signal: AbortSignal.timeout(5000),
+  });
+  if (!resp.ok) throw new Error(`balance returned ${resp.status}`);
+  return resp.json();
+}
+
+export async function getServerBalanceHistory(limit = 50) {
+  const resp = await fetch(`${GO_SERVER_URL}/balance/history?limit=${limit}`, {
+    signal: AbortSignal.timeout(5000),
+  });
+  if (!resp.ok) throw new Error(`balance/history returned ${resp.status}`);
+  return resp.json();
+}
+
+/**
+ * POST a payload to one of the /ingest routes and return the parsed reply.
+ */
+export async function postIngest(route, payload) {
+  const resp = await fetch(`${GO_SERVER_URL}/ingest/${route}`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(payload),
+    signal: AbortSignal.timeout(5000),
+  });
+  if (!resp.ok) throw new Error(`ingest/${route} returned ${resp.status}: ${await resp.text()}`);
+  return resp.json();
+}
@@ -0,0 +1,149 @@
+import { navigateToPopup, getPopupDiagnostics } from '../helpers/popup-dom.js';
+import { getServerStatus } from '../helpers/server-api.js';
+import { GO_SERVER_URL, POPUP_URL } from '../helpers/constants.js';
+
+const WS_URL = `${GO_SERVER_URL.replace(/^http/, 'ws')}/ws`;
+
+// The second client is a plain WebSocket opened in its own extension tab, so
+// reloading the popup tab does not drop it. It reconnects every 200ms, which
+// lets it win the race against the extension's backoff after a restart.
+async function openPeer() {
+  const popupHandle = await browser.getWindowHandle();
+  const peerHandle = await browser.newWindow(POPUP_URL);
+  await browser.execute((url) => {
+    const peer = { messages: [], socket: null, closed: false };
+    window.__refreshPeer = peer;
+    const connect = () => {
+      if (peer.closed) return;
+      const socket = new WebSocket(url);
+      peer.socket = socket;
+      socket.onopen = () => {
+        socket.send(JSON.stringify({
+          id: `peer-hello-${Date.now()}`,
+          type: 'hello',
+          payload: {
+            protocol_version: 1,
+            extension_version: 'wdio-peer',
+            capabilities: ['refresh-coordination'],
+          },
+        }));
+      };
+      socket.onmessage = (event) => peer.messages.push(JSON.parse(event.data));
+      socket.onclose = () => {
+        if (peer.socket !== socket) return;
+        peer.socket = null;
+        setTimeout(connect, 200);
+      };
+    };
+    connect();
+  }, WS_URL);
+  await browser.switchToWindow(popupHandle);
+  return { popupHandle, peerHandle };
+}
+
+async function peerRoles(handles) {
+  await browser.switchToWindow(handles.peerHandle);
+  const roles = await browser.execute(() =>
+    window.__refreshPeer.messages
+      .filter((m) => m.type === 'refresh-lead' || m.type === 'refresh-standby')
+      .map((m) => m.type),
+  );
+  await browser.switchToWindow(handles.popupHandle);
+  return roles;
+}
+
+async function closePeer(handles) {
+  await browser.switchToWindow(handles.peerHandle);
+  await browser.execute(() => {
+    const peer = window.__refreshPeer;
+    peer.closed = true;
+    if (peer.socket) peer.socket.close();
+  });
+  await browser.closeWindow();
+  await browser.switchToWindow(handles.popupHandle);
+}
+
+async function waitFor(read, accept, label, timeout = 20_000) {
+  const deadline = Date.now() + timeout;
+  let last;
+  while (Date.now() < deadline) {
+    last = await read();
+    if (accept(last)) return last;
+    await browser.pause(500);
+  }
+  throw new Error(`${label}. Last value: ${JSON.stringify(last)}`);
+}
+
+async function extensionRole() {
+  await browser.refresh();
+  await (await $('#syncDot')).waitForDisplayed({ timeout: 10_000 });
+  const diagnostics = await getPopupDiagnostics();
+  return diagnostics['Refresh Role'];
+}
+
+describe('Refresh Leader Election', () => {
+  let handles = null;
+
+  afterEach(async () => {
+    if (handles) {
+      await closePeer(handles);
+      handles = null;
+    }
+  });
+
+  it('should make the extension lead while it is the only client', async () => {
+    await navigateToPopup();
+
+    const status = await waitFor(
+      getServerStatus,
+      (s) => s.refresh_leader.participants === 1 && s.refresh_leader.leader !== null,
+      'Extension did not join the refresh election',
+    );
+    expect(status.refresh_leader.leader.extension_version).not.toBe('wdio-peer');
+    await waitFor(extensionRole, (role) => role === 'lead', 'Extension did not become lead');
+  });
+
+  it('should put a second client on standby', async () => {
+    const before = await getServerStatus();
+    handles = await openPeer();
+
+    await waitFor(
+      () => peerRoles(handles),
+      (roles) => roles.includes('refresh-standby'),
+      'Peer was not put on standby',
+    );
+    const status = await getServerStatus();
+    expect(status.refresh_leader.participants).toBe(2);
+    expect(status.refresh_leader.leader.client_id).toBe(before.refresh_leader.leader.client_id);
+    expect(await extensionRole()).toBe('lead');
+  });
+
+  it('should stand the extension by while another client leads @slow', async () => {
+    const goServer = browser.goServer;
+    await goServer.stop();
+    // Let the extension's reconnect backoff grow so the peer, retrying every
+    // 200ms, connects first after the restart.
+    await browser.pause(8000);
+    handles = await openPeer();
+    goServer.start();
+    await goServer.waitHealthy();
+
+    await waitFor(
+      () => peerRoles(handles),
+      (roles) => roles.at(-1) === 'refresh-lead',
+      'Peer did not lead after the restart',
+    );
+    await waitFor(
+      getServerStatus,
+      (s) => s.refresh_leader.participants === 2,
+      'Extension did not rejoin the refresh election',
+      40_000,
+    );
+    await waitFor(extensionRole, (role) => role === 'standby', 'Extension did not stand by');
+
+    // Once the leader leaves, the extension takes over refreshing.
+    await closePeer(handles);
+    handles = null;
+    await waitFor(extensionRole, (role) => role === 'lead', 'Extension did not resume as lead');
+  });
+});
@@ -0,0 +1,66 @@
+import { navigateToPopup, getPopupStatus } from '../helpers/popup-dom.js';
+import { getServerStatus, pairServer } from '../helpers/server-api.js';
+import { GO_SERVER_URL } from '../helpers/constants.js';
+
+async function restartServer(auth) {
+  const goServer = browser.goServer;
+  await goServer.stop();
+  goServer.auth = auth;
+  goServer.start();
+  await goServer.waitHealthy();
+}
+
+describe('Service Pairing', () => {
+  before(async () => {
+    await restartServer(true);
+  });
+
+  after(async () => {
+    await restartServer(false);
+  });
+
+  it('should reject requests without a token', async () => {
+    const resp = await fetch(`${GO_SERVER_URL}/status`, {
+      signal: AbortSignal.timeout(5000),
+    });
+    expect(resp.status).toBe(401);
+  });
+
+  it('should pair the extension from the settings tab', async () => {
+    const code = browser.goServer.createPairingCode();
+
+    await navigateToPopup();
+    await (await $('button[data-tab="settings"]')).click();
+    await browser.pause(300);
+    await (await $('#servicePairingCodeInput')).setValue(code);
+    await (await $('#servicePairButton')).click();
+
+    const status = await $('#servicePairingStatus');
+    await status.waitUntil(
+      async () => (await status.getText()).startsWith('Paired'),
+      { timeout: 10_000, timeoutMsg: 'Pairing status never showed Paired' },
+    );
+  });
+
+  it('should connect the extension socket with the paired token', async () => {
+    const token = await pairServer(browser.goServer.createPairingCode());
+
+    const deadline = Date.now() + 20_000;
+    let status = null;
+    while (Date.now() < deadline) {
+      status = await getServerStatus(token);
+      if (status.extension.connected_clients > 0) break;
+      await browser.pause(1000);
+    }
+    expect(status.extension.connected_clients).toBeGreaterThan(0);
+  });
+
+  it('should load the dashboard with the paired token', async () => {
+    await navigateToPopup();
+    await browser.pause(2000);
+
+    const status = await getPopupStatus();
+    expect(status.refresh_text).not.toBe('Offline');
+    expect(status.dot_bad).toBe(false);
+  });
+});
@@ -0,0 +1,52 @@
+import {
+  getServerBalance,
+  getServerBalanceHistory,
+  postIngest,
+} from '../helpers/server-api.js';
+import { PROLIFIC_STUDIES_URL } from '../helpers/constants.js';
+
+const BALANCE_URL = 'https://internal-api.prolific.com/api/v1/users/wdio-user/balance/';
+
+describe('Balance Tracking', () => {
+  it('should store the balance the Prolific app loads', async () => {
+    const before = await getServerBalance();
+    const beforeAt = before.has_balance ? before.balance.last_observed_at : null;
+
+    await browser.url(PROLIFIC_STUDIES_URL);
+    await browser.pause(3000);
+
+    const deadline = Date.now() + 15_000;
+    let balance = before;
+    while (Date.now() < deadline) {
+      balance = await getServerBalance();
+      if (balance.has_balance && balance.balance.last_observed_at !== beforeAt) break;
+      await browser.pause(2000);
+    }
+
+    expect(balance.has_balance).toBe(true);
+    expect(balance.balance.last_observed_at).not.toBe(beforeAt);
+    expect(balance.balance.currency).toMatch(/^[A-Z]{3}$/);
+  });
+
+  it('should record an ingested balance snapshot in the history', async () => {
+    const before = await getServerBalance();
+    // Move away from the current balance so the snapshot counts as a change.
+    const available = (before.has_balance ? before.balance.available : 0) + 1234;
+
+    const ack = await postIngest('intercepted-response', {
+      url: BALANCE_URL,
+      status_code: 200,
+      observed_at: new Date().toISOString(),
+      body: { available_balance: available, pending_balance: 56, currency_code: 'GBP' },
+    });
+    expect(ack.route).toBe('participant.balance');
+    expect(ack.change).toBeDefined();
+
+    const latest = await getServerBalance();
+    expect(latest.balance.available).toBe(available);
+    expect(latest.balance.currency).toBe('GBP');
+
+    const history = await getServerBalanceHistory();
+    expect(history.results.some((item) => item.available === available)).toBe(true);
+  });
+});
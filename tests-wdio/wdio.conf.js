@@ -26,6 +26,9 @@ export const config = {
     './specs/05-settings.js',
     './specs/06-studies-intercept.js',
     './specs/07-debug-state.js',
+    './specs/08-refresh-leader.js',
+    './specs/09-auth-pairing.js',
+    './specs/10-balance.js',
   ]],
   maxInstances: 1,
 
@@ -24,8 +24,10 @@ const (
 	wsTypeStudiesResponse           = "receive-studies-response"
 	wsTypeSubmission                = "receive-submission-response"
 	wsTypeParticipantSubs           = "receive-participant-submissions-response"
+	wsTypeInterceptedResponse       = "receive-intercepted-response"
 	wsTypeDebugState                = "report-debug-state"
 	wsTypeStudiesRefreshEvent       = "studies_refresh_event"
+	wsTypeBalanceChangedEvent       = "balance_changed_event"
 	wsWriteTimeout                  = 10 * time.Second
 	wsReadLimitBytes          int64 = 8 << 20
 )
@@ -44,11 +46,21 @@ type wsServerMessage struct {
 	Error string `json:"error,omitempty"`
 	Data  any    `json:"data,omitempty"`
 	At    string `json:"at,omitempty"`
+	Seq   int64  `json:"seq,omitempty"`
 }
 
 type wsConnClient struct {
-	conn    *websocket.Conn
-	writeMu sync.Mutex
+	conn     *websocket.Conn
+	outbound *wsOutbound
+	info     wsClientInfo
+	activity wsClientActivity
+
+	helloMu sync.Mutex
+	hello   *wsClientHello
+
+	// topics is nil until the client subscribes; see wsDefaultTopics.
+	topicsMu sync.Mutex
+	topics   map[string]struct{}
 }
 
 func (s *Service) handleExtensionWebSocket(w http.ResponseWriter, r *http.Request) {
@@ -66,14 +78,25 @@ func (s *Service) handleExtensionWebSocket(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	client := &wsConnClient{conn: conn}
+	client := &wsConnClient{
+		conn:     conn,
+		outbound: newWSOutbound(s.config.WSQueueSize, s.config.WSSlowConsumerPolicy),
+		info:     newWSClientInfo(r),
+	}
+	writerCtx, stopWriter := context.WithCancel(context.Background())
+	go s.runWSWriter(writerCtx, client)
+	go s.runWSPinger(writerCtx, client)
+	logInfo("ws.connected", "client_id", client.info.ID, "remote_addr", client.info.RemoteAddr, "origin", client.info.Origin)
 	s.addWSClient(client)
 	defer s.removeWSClient(client)
 
 	closeCode := websocket.StatusNormalClosure
 	closeReason := ""
 	defer func() {
+		stopWSWriter(client)
+		stopWriter()
 		_ = conn.Close(closeCode, closeReason)
+		logInfo("ws.disconnected", "client_id", client.info.ID, "messages_in", client.activity.messagesIn.Load(), "messages_out", client.outbound.sent.Load())
 	}()
 
 	conn.SetReadLimit(wsReadLimitBytes)
@@ -91,12 +114,30 @@ func (s *Service) handleExtensionWebSocket(w http.ResponseWriter, r *http.Reques
 			closeReason = "read failed"
 			return
 		}
+		client.activity.received(time.Now())
+		if s.wsTokenRevoked(client) {
+			closeCode = websocket.StatusPolicyViolation
+			closeReason = wsTokenRevokedReason
+			return
+		}
 
-		response := s.handleWSRequest(request)
-		if err := s.writeWSMessage(ctx, client, response); err != nil {
-			logWarn("ws.write_failed", "error", err)
-			closeCode = websocket.StatusInternalError
-			closeReason = "write failed"
+		var response wsServerMessage
+		incompatible := ""
+		switch strings.TrimSpace(request.Type) {
+		case wsTypeHello:
+			response, incompatible = s.handleWSHello(client, request)
+		case wsTypeSubscribe, wsTypeUnsubscribe:
+			response = s.handleWSSubscription(client, request)
+		case wsTypeResume:
+			response = s.handleWSResume(client, request)
+		default:
+			response = s.handleWSRequest(dedupeScope(client.info.TokenID), request)
+		}
+		s.sendWS(client, response)
+		s.trackRefreshElection(client)
+		if incompatible != "" {
+			closeCode = websocket.StatusPolicyViolation
+			closeReason = incompatible
 			return
 		}
 	}
@@ -120,6 +161,7 @@ func (s *Service) removeWSClient(client *wsConnClient) {
 	s.wsClientsMu.Lock()
 	delete(s.wsClientsSet, client)
 	s.wsClientsMu.Unlock()
+	s.leaveRefreshElection(client)
 }
 
 func (s *Service) snapshotWSClients() []*wsConnClient {
@@ -133,19 +175,6 @@ func (s *Service) snapshotWSClients() []*wsConnClient {
 	return clients
 }
 
-func (s *Service) writeWSMessage(parentCtx context.Context, client *wsConnClient, message wsServerMessage) error {
-	if client == nil || client.conn == nil {
-		return errors.New("invalid websocket client")
-	}
-
-	client.writeMu.Lock()
-	defer client.writeMu.Unlock()
-
-	writeCtx, cancel := context.WithTimeout(parentCtx, wsWriteTimeout)
-	defer cancel()
-	return wsjson.Write(writeCtx, client.conn, message)
-}
-
 func (s *Service) broadcastStudiesRefreshEvent(update StudiesRefreshUpdate) {
 	observedAt := utcNowOr(update.ObservedAt)
 	data := map[string]any{
@@ -160,21 +189,54 @@ func (s *Service) broadcastStudiesRefreshEvent(update StudiesRefreshUpdate) {
 	if len(update.BecameUnavailableStudyIDs) > 0 {
 		data["became_unavailable_study_ids"] = update.BecameUnavailableStudyIDs
 	}
-	event := wsServerMessage{
+	if len(update.UpdatedStudies) > 0 {
+		data["updated_studies"] = update.UpdatedStudies
+	}
+	if len(update.ReopenedStudies) > 0 {
+		data["reopened_studies"] = update.ReopenedStudies
+	}
+	s.broadcastWSEvent(wsTopicStudies, wsServerMessage{
 		Type: wsTypeStudiesRefreshEvent,
 		Data: data,
 		At:   observedAt.Format(time.RFC3339Nano),
+	})
+}
+
+func (s *Service) broadcastBalanceChangedEvent(change BalanceChange) {
+	s.broadcastWSEvent(wsTopicBalance, wsServerMessage{
+		Type: wsTypeBalanceChangedEvent,
+		Data: change,
+		At:   change.Current.ObservedAt.Format(time.RFC3339Nano),
+	})
+}
+
+// broadcastWSEvent stamps event with the next sequence number, buffers it
+// for resume and queues it for every client subscribed to topic. It never
+// waits on a client's connection.
+func (s *Service) broadcastWSEvent(topic string, event wsServerMessage) {
+	s.wsBroadcastMu.Lock()
+	defer s.wsBroadcastMu.Unlock()
+
+	if s.wsEventsStore != nil {
+		seq, err := s.wsEventsStore.Append(topic, event)
+		if err != nil {
+			logWarn("ws.event_persist_failed", "type", event.Type, "error", err)
+		}
+		event.Seq = seq
 	}
 
 	clients := s.snapshotWSClients()
 	for _, client := range clients {
-		if err := s.writeWSMessage(context.Background(), client, event); err != nil {
-			logWarn("ws.broadcast_failed", "type", wsTypeStudiesRefreshEvent, "error", err)
+		if !client.subscribed(topic) {
+			continue
 		}
+		s.pushWS(client, event)
 	}
 }
 
-func (s *Service) handleWSRequest(request wsClientMessage) wsServerMessage {
+// handleWSRequest processes one request. scope keeps the dedupe cache of
+// one client from answering another's requests.
+func (s *Service) handleWSRequest(scope string, request wsClientMessage) wsServerMessage {
 	requestType := strings.TrimSpace(request.Type)
 	requestID := strings.TrimSpace(request.ID)
 
@@ -196,31 +258,48 @@ func (s *Service) handleWSRequest(request wsClientMessage) wsServerMessage {
 		return response
 	}
 
-	result, err := s.dispatchWSRequest(requestType, request.Payload)
-	if err != nil {
-		response.OK = false
-		response.Error = wsErrorMessage(err)
-		logWarn("ws.request_failed", "type", requestType, "id", requestID, "error", err)
-		return response
-	}
+	return s.dedupeWSRequest(scope, request, func() wsServerMessage {
+		var result map[string]any
+		var err error
+		if requestType == wsTypeBatch {
+			result, err = s.processBatch(scope, request.Payload)
+		} else {
+			result, err = s.dispatchWSRequest(requestType, request.Payload)
+		}
+		if err != nil {
+			response.OK = false
+			response.Error = wsErrorMessage(err)
+			logWarn("ws.request_failed", "type", requestType, "id", requestID, "error", err)
+			return response
+		}
 
-	response.OK = true
-	response.Data = result
-	return response
+		response.OK = true
+		response.Data = result
+		return response
+	})
 }
 
 func (s *Service) dispatchWSRequest(requestType string, payload json.RawMessage) (map[string]any, error) {
 	switch requestType {
 	case wsTypeStudiesRefresh:
-		return decodeWSAndDispatch(payload, true, s.processReceiveStudiesRefresh)
-	case wsTypeStudiesResponse:
-		return decodeWSAndDispatch(payload, true, s.processReceiveStudiesResponse)
-	case wsTypeSubmission:
-		return decodeWSAndDispatch(payload, true, s.processReceiveSubmissionResponse)
-	case wsTypeParticipantSubs:
-		return decodeWSAndDispatch(payload, true, s.processReceiveParticipantSubmissionsResponse)
+		return decodeWSAndDispatch(payload, true, func(parsed StudiesRefreshUpdate) (map[string]any, error) {
+			s.captureStudiesRefresh(parsed)
+			return s.processReceiveStudiesRefresh(parsed)
+		})
+	case wsTypeInterceptedResponse:
+		return decodeWSAndDispatch(payload, true, func(parsed interceptedResponsePayload) (map[string]any, error) {
+			s.captureInterceptedResponse(requestType, parsed)
+			return s.routeInterceptedResponse(parsed, "")
+		})
+	case wsTypeStudiesResponse, wsTypeSubmission, wsTypeParticipantSubs:
+		return decodeWSAndDispatch(payload, true, func(parsed interceptedResponsePayload) (map[string]any, error) {
+			s.captureInterceptedResponse(requestType, parsed)
+			return s.routeInterceptedResponse(parsed, requestType)
+		})
 	case wsTypeDebugState:
 		return s.processDebugState(payload)
+	case wsTypeQueryStudies, wsTypeQueryEvents, wsTypeQuerySubmissions, wsTypeQueryStatus:
+		return s.dispatchWSQuery(requestType, payload)
 	default:
 		return nil, badRequest(fmt.Sprintf("unknown message type %q", requestType))
 	}
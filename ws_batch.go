@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const wsTypeBatch = "batch"
+
+type wsBatchPayload struct {
+	Messages []wsClientMessage `json:"messages"`
+}
+
+type wsBatchItemResult struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	Type  string `json:"type"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	Data  any    `json:"data,omitempty"`
+}
+
+// processBatch runs the sub-messages in order and reports a result for each.
+// A failing item does not stop the ones after it. Consecutive submission
+// messages are stored in one transaction and their captures in one write.
+// Other items still commit on their own: the stores share a single SQLite
+// connection and read outside their transactions, and a studies response
+// must be reconciled before the next one is applied.
+func (s *Service) processBatch(scope string, payload json.RawMessage) (map[string]any, error) {
+	var batch wsBatchPayload
+	if err := decodeWSPayload(payload, &batch, true); err != nil {
+		return nil, err
+	}
+	if len(batch.Messages) == 0 {
+		return nil, badRequest("messages cannot be empty")
+	}
+	if len(batch.Messages) > wsMaxBatchItems {
+		return nil, badRequest(fmt.Sprintf("batch holds %d messages; at most %d are allowed", len(batch.Messages), wsMaxBatchItems))
+	}
+
+	results := make([]wsBatchItemResult, len(batch.Messages))
+	var group []*wsBatchSubmission
+	flush := func() {
+		s.applyBatchSubmissions(group, results)
+		group = group[:0]
+	}
+
+	for index, item := range batch.Messages {
+		itemType := strings.TrimSpace(item.Type)
+		results[index] = wsBatchItemResult{Index: index, ID: strings.TrimSpace(item.ID), Type: itemType}
+
+		switch itemType {
+		case wsTypeBatch, wsTypeHello, wsTypeSubscribe, wsTypeUnsubscribe, wsTypeResume:
+			results[index].Error = fmt.Sprintf("%q is not allowed inside a batch", itemType)
+			continue
+		}
+
+		if submission := s.prepareBatchSubmission(scope, index, item, group); submission != nil {
+			group = append(group, submission)
+			continue
+		}
+
+		flush()
+		response := s.handleWSRequest(scope, item)
+		results[index].setResponse(response)
+	}
+	flush()
+
+	failed := 0
+	for _, result := range results {
+		if !result.OK {
+			failed++
+		}
+	}
+
+	logInfo("ws.batch_processed", "items", len(results), "failed", failed)
+	return map[string]any{
+		"results":   results,
+		"succeeded": len(results) - failed,
+		"failed":    failed,
+	}, nil
+}
+
+func (r *wsBatchItemResult) setResponse(response wsServerMessage) {
+	r.OK = response.OK || response.Type == wsTypeHeartbeatAck
+	r.Error = response.Error
+	r.Data = response.Data
+}
+
+// wsBatchSubmission is a batch item headed for a submission route, held
+// back so its writes can share a transaction with its neighbours.
+type wsBatchSubmission struct {
+	index   int
+	request wsClientMessage
+	wsType  string
+	route   interceptRoute
+	capture *Capture
+	ingest  *submissionIngest
+	err     error
+	cached  *wsServerMessage
+	key     string
+	hash    string
+	// duplicateOf is an earlier item of the same group with the same key and
+	// payload; this item takes its result instead of being applied again.
+	duplicateOf *wsBatchSubmission
+}
+
+// prepareBatchSubmission decodes item when it targets a submission route and
+// returns nil for everything else, which is then processed on its own. group
+// holds the items not yet stored, which the dedupe cache cannot see.
+func (s *Service) prepareBatchSubmission(scope string, index int, item wsClientMessage, group []*wsBatchSubmission) *wsBatchSubmission {
+	requestType := strings.TrimSpace(item.Type)
+	wsType := requestType
+	switch requestType {
+	case wsTypeInterceptedResponse:
+		wsType = ""
+	case wsTypeSubmission, wsTypeParticipantSubs:
+	default:
+		return nil
+	}
+
+	var payload interceptedResponsePayload
+	if err := decodeWSPayload(item.Payload, &payload, true); err != nil {
+		return nil
+	}
+	route, response, err := s.matchInterceptRoute(payload, wsType)
+	if err != nil || route.prepareSubmissions == nil {
+		return nil
+	}
+
+	submission := &wsBatchSubmission{index: index, request: item, wsType: wsType, route: route}
+	submission.key, submission.hash = wsDedupeKey(scope, item)
+	if submission.key != "" && s.dedupe.enabled() {
+		for _, earlier := range group {
+			if earlier.key == submission.key && earlier.hash == submission.hash {
+				logInfo("dedupe.ws_duplicate", "type", requestType, "id", strings.TrimSpace(item.ID), "batch", true)
+				submission.duplicateOf = earlier
+				return submission
+			}
+		}
+		if cached, ok := s.lookupWSDuplicate(item, submission.key, submission.hash, time.Now()); ok {
+			submission.cached = &cached
+			return submission
+		}
+	}
+
+	if s.capturesStore != nil {
+		capture := interceptedCapture(requestType, payload)
+		submission.capture = &capture
+	}
+	s.observeSchema(route.name, response.interceptedResponsePayload)
+	submission.ingest, submission.err = route.prepareSubmissions(response)
+	return submission
+}
+
+// applyBatchSubmissions stores the group's captures in one write and its
+// submission writes in one transaction, then fills in each item's result.
+func (s *Service) applyBatchSubmissions(group []*wsBatchSubmission, results []wsBatchItemResult) {
+	if len(group) == 0 {
+		return
+	}
+
+	var captures []Capture
+	var pending []*wsBatchSubmission
+	var ingests []*submissionIngest
+	for _, submission := range group {
+		if submission.capture != nil {
+			captures = append(captures, *submission.capture)
+		}
+		if submission.cached == nil && submission.err == nil && submission.duplicateOf == nil {
+			pending = append(pending, submission)
+			ingests = append(ingests, submission.ingest)
+		}
+	}
+	s.recordCaptures(captures...)
+
+	acks, err := s.applySubmissionIngests(ingests)
+	now := time.Now()
+	for index, submission := range pending {
+		if err != nil {
+			submission.err = badRequest(submission.ingest.failure)
+			continue
+		}
+		response := wsServerMessage{
+			Type: wsTypeAck,
+			ID:   strings.TrimSpace(submission.request.ID),
+			OK:   true,
+			Data: submission.route.tagResult(acks[index], submission.wsType),
+		}
+		s.dedupe.store(submission.key, submission.hash, response, now)
+		submission.cached = &response
+	}
+
+	for _, submission := range group {
+		result := &results[submission.index]
+		if original := submission.duplicateOf; original != nil {
+			submission.cached, submission.err = original.cached, original.err
+		}
+		if submission.cached != nil {
+			result.setResponse(*submission.cached)
+			continue
+		}
+		result.Error = wsErrorMessage(submission.err)
+		logWarn("ws.request_failed", "type", result.Type, "id", result.ID, "error", submission.err)
+	}
+	logInfo("ws.batch_submissions_stored", "items", len(group), "stored", len(ingests), "failed", err != nil)
+}
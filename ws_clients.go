@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+const (
+	defaultWSPingInterval = 30 * time.Second
+	wsPongTimeout         = 10 * time.Second
+	wsTokenRevokedReason  = "token revoked"
+)
+
+var wsClientIDs atomic.Int64
+
+// wsClientInfo is the connection metadata captured at accept time.
+type wsClientInfo struct {
+	ID          int64
+	TokenID     int64
+	RemoteAddr  string
+	Origin      string
+	UserAgent   string
+	ConnectedAt time.Time
+}
+
+// wsClientActivity is updated from the read loop and the pinger.
+type wsClientActivity struct {
+	lastMessageAt atomic.Int64
+	lastPongAt    atomic.Int64
+	messagesIn    atomic.Int64
+	pings         atomic.Int64
+}
+
+func newWSClientInfo(r *http.Request) wsClientInfo {
+	return wsClientInfo{
+		ID:          wsClientIDs.Add(1),
+		TokenID:     requestTokenID(r),
+		RemoteAddr:  r.RemoteAddr,
+		Origin:      strings.TrimSpace(r.Header.Get("Origin")),
+		UserAgent:   strings.TrimSpace(r.Header.Get("User-Agent")),
+		ConnectedAt: time.Now().UTC(),
+	}
+}
+
+func (a *wsClientActivity) received(at time.Time) {
+	a.messagesIn.Add(1)
+	a.lastMessageAt.Store(at.UnixNano())
+}
+
+func (a *wsClientActivity) idleSince(connectedAt time.Time) time.Time {
+	last := connectedAt
+	for _, nanos := range []int64{a.lastMessageAt.Load(), a.lastPongAt.Load()} {
+		if nanos > 0 && time.Unix(0, nanos).After(last) {
+			last = time.Unix(0, nanos)
+		}
+	}
+	return last
+}
+
+func unixNanoTime(nanos int64) *time.Time {
+	if nanos == 0 {
+		return nil
+	}
+	t := time.Unix(0, nanos).UTC()
+	return &t
+}
+
+// wsTokenRevoked reports whether the token client connected with has been
+// revoked since, e.g. by `token revoke` run from another process.
+func (s *Service) wsTokenRevoked(client *wsConnClient) bool {
+	if !s.authEnabled() || client.info.TokenID == 0 {
+		return false
+	}
+	active, err := s.tokensStore.IsActive(client.info.TokenID)
+	if err != nil {
+		logWarn("ws.token_check_failed", "client_id", client.info.ID, "token_id", client.info.TokenID, "error", err)
+		return false
+	}
+	if !active {
+		logWarn("ws.token_revoked", "client_id", client.info.ID, "token_id", client.info.TokenID, "remote_addr", client.info.RemoteAddr)
+	}
+	return !active
+}
+
+// runWSPinger pings a client that has been silent for a full interval and
+// closes the connection when the pong does not arrive in time. Half-open
+// connections would otherwise stay registered until a write failed. Each tick
+// also drops a client whose token was revoked, even if it never sends.
+func (s *Service) runWSPinger(ctx context.Context, client *wsConnClient) {
+	interval := s.config.WSPingInterval
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if s.wsTokenRevoked(client) {
+				_ = client.conn.Close(websocket.StatusPolicyViolation, wsTokenRevokedReason)
+				return
+			}
+			if now.Sub(client.activity.idleSince(client.info.ConnectedAt)) < interval {
+				continue
+			}
+
+			client.activity.pings.Add(1)
+			pingCtx, cancel := context.WithTimeout(ctx, wsPongTimeout)
+			err := client.conn.Ping(pingCtx)
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				logWarn("ws.pong_timeout", "client_id", client.info.ID, "remote_addr", client.info.RemoteAddr, "error", err)
+				_ = client.conn.CloseNow()
+				return
+			}
+			client.activity.lastPongAt.Store(time.Now().UnixNano())
+		}
+	}
+}
+
+type wsClientView struct {
+	ID               int64        `json:"id"`
+	TokenID          int64        `json:"token_id,omitempty"`
+	RemoteAddr       string       `json:"remote_addr"`
+	Origin           string       `json:"origin,omitempty"`
+	UserAgent        string       `json:"user_agent,omitempty"`
+	ExtensionVersion string       `json:"extension_version,omitempty"`
+	ProtocolVersion  int          `json:"protocol_version,omitempty"`
+	ConnectedAt      time.Time    `json:"connected_at"`
+	LastMessageAt    *time.Time   `json:"last_message_at,omitempty"`
+	LastPongAt       *time.Time   `json:"last_pong_at,omitempty"`
+	MessagesIn       int64        `json:"messages_in"`
+	MessagesOut      int64        `json:"messages_out"`
+	Pings            int64        `json:"pings"`
+	Topics           []string     `json:"topics"`
+	Queue            wsQueueStats `json:"queue"`
+}
+
+func (c *wsConnClient) view() wsClientView {
+	queue := c.outbound.stats()
+	view := wsClientView{
+		ID:            c.info.ID,
+		TokenID:       c.info.TokenID,
+		RemoteAddr:    c.info.RemoteAddr,
+		Origin:        c.info.Origin,
+		UserAgent:     c.info.UserAgent,
+		ConnectedAt:   c.info.ConnectedAt,
+		LastMessageAt: unixNanoTime(c.activity.lastMessageAt.Load()),
+		LastPongAt:    unixNanoTime(c.activity.lastPongAt.Load()),
+		MessagesIn:    c.activity.messagesIn.Load(),
+		MessagesOut:   queue.Sent,
+		Pings:         c.activity.pings.Load(),
+		Topics:        c.currentTopics(),
+		Queue:         queue,
+	}
+	if hello := c.getHello(); hello != nil {
+		view.ExtensionVersion = hello.ExtensionVersion
+		view.ProtocolVersion = hello.ProtocolVersion
+	}
+	return view
+}
+
+func (s *Service) handleDebugClients(w http.ResponseWriter, _ *http.Request) {
+	clients := s.snapshotWSClients()
+	views := make([]wsClientView, 0, len(clients))
+	for _, client := range clients {
+		views = append(views, client.view())
+	}
+	slices.SortFunc(views, func(a, b wsClientView) int {
+		return int(a.ID - b.ID)
+	})
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"count":         len(views),
+		"ping_interval": s.config.WSPingInterval.String(),
+		"clients":       views,
+	})
+}
+
+// closeWSClient is used by the policies that end a connection from outside
+// its read loop.
+func closeWSClient(client *wsConnClient, code websocket.StatusCode, reason string) {
+	client.outbound.close()
+	go func() {
+		_ = client.conn.Close(code, reason)
+	}()
+}
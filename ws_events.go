@@ -0,0 +1,172 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	wsTypeResume = "resume"
+
+	// wsEventBufferSize is how many broadcasts are kept for resume.
+	wsEventBufferSize = 1000
+
+	wsResyncError = "gap too large, resync"
+)
+
+// WSEventsStore is the SQLite-backed ring buffer of sequenced broadcasts.
+type WSEventsStore struct{ db *sql.DB }
+
+func NewWSEventsStore(db *sql.DB) *WSEventsStore { return &WSEventsStore{db: db} }
+
+type storedWSEvent struct {
+	Seq     int64
+	Topic   string
+	Message wsServerMessage
+}
+
+// Append stores message under the next sequence number, drops events that
+// fell out of the buffer and returns the sequence number.
+func (s *WSEventsStore) Append(topic string, message wsServerMessage) (int64, error) {
+	messageJSON, err := json.Marshal(message)
+	if err != nil {
+		return 0, fmt.Errorf("marshal ws event: %w", err)
+	}
+
+	var seq int64
+	err = withTx(s.db, func(tx *sql.Tx) error {
+		if err := tx.QueryRow(
+			`INSERT INTO ws_events (topic, type, message_json, created_at)
+			 VALUES (?, ?, ?, ?)
+			 RETURNING seq`,
+			topic,
+			message.Type,
+			string(messageJSON),
+			formatTime(time.Now().UTC()),
+		).Scan(&seq); err != nil {
+			return fmt.Errorf("insert ws event: %w", err)
+		}
+		if _, err := tx.Exec(`DELETE FROM ws_events WHERE seq <= ?`, seq-wsEventBufferSize); err != nil {
+			return fmt.Errorf("trim ws events: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// Bounds returns the oldest and latest buffered sequence numbers, or zeros
+// when the buffer is empty.
+func (s *WSEventsStore) Bounds() (int64, int64, error) {
+	var oldest, latest sql.NullInt64
+	if err := s.db.QueryRow(`SELECT MIN(seq), MAX(seq) FROM ws_events`).Scan(&oldest, &latest); err != nil {
+		return 0, 0, fmt.Errorf("load ws event bounds: %w", err)
+	}
+	return oldest.Int64, latest.Int64, nil
+}
+
+func (s *WSEventsStore) Since(lastSeq int64) ([]storedWSEvent, error) {
+	rows, err := s.db.Query(
+		`SELECT seq, topic, message_json FROM ws_events WHERE seq > ? ORDER BY seq ASC`,
+		lastSeq,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query ws events: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]storedWSEvent, 0)
+	for rows.Next() {
+		var event storedWSEvent
+		var messageJSON string
+		if err := rows.Scan(&event.Seq, &event.Topic, &messageJSON); err != nil {
+			return nil, fmt.Errorf("scan ws event: %w", err)
+		}
+		if err := json.Unmarshal([]byte(messageJSON), &event.Message); err != nil {
+			return nil, fmt.Errorf("parse ws event %d: %w", event.Seq, err)
+		}
+		event.Message.Seq = event.Seq
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate ws events: %w", err)
+	}
+	return events, nil
+}
+
+type wsResumePayload struct {
+	LastSeq *int64 `json:"last_seq"`
+}
+
+// handleWSResume queues the buffered events after last_seq that the client
+// is subscribed to as ordinary broadcasts, then acks.
+func (s *Service) handleWSResume(client *wsConnClient, request wsClientMessage) wsServerMessage {
+	response := wsServerMessage{Type: wsTypeAck, ID: strings.TrimSpace(request.ID)}
+	if s.wsEventsStore == nil {
+		response.Error = "resume is not available"
+		return response
+	}
+
+	var payload wsResumePayload
+	if err := decodeWSPayload(request.Payload, &payload, true); err != nil {
+		response.Error = wsErrorMessage(err)
+		return response
+	}
+	if payload.LastSeq == nil || *payload.LastSeq < 0 {
+		response.Error = "last_seq must be a non-negative integer"
+		return response
+	}
+	lastSeq := *payload.LastSeq
+
+	// The lock only keeps the bounds and the read consistent with concurrent
+	// appends. Replays are queued after it is released, so a live event may
+	// overtake them; clients drop repeats by seq.
+	s.wsBroadcastMu.Lock()
+	oldest, latest, err := s.wsEventsStore.Bounds()
+	var events []storedWSEvent
+	if err == nil && !resumeGapTooLarge(lastSeq, oldest, latest) {
+		events, err = s.wsEventsStore.Since(lastSeq)
+	}
+	s.wsBroadcastMu.Unlock()
+	if err != nil {
+		logWarn("ws.resume_failed", "error", err)
+		response.Error = "failed to load buffered events"
+		return response
+	}
+
+	replays := make([]wsServerMessage, 0, len(events))
+	for _, event := range events {
+		if client.subscribed(event.Topic) {
+			replays = append(replays, event.Message)
+		}
+	}
+
+	// A replay that would not fit the client's queue is answered like a gap:
+	// the client reloads instead of the queue dropping or disconnecting.
+	if resumeGapTooLarge(lastSeq, oldest, latest) || len(replays) > client.outbound.size {
+		response.Error = wsResyncError
+		response.Data = map[string]any{"resync": true, "oldest_seq": oldest, "latest_seq": latest}
+		logInfo("ws.resume_resync", "last_seq", lastSeq, "oldest_seq", oldest, "latest_seq", latest, "pending", len(replays))
+		return response
+	}
+
+	for _, replay := range replays {
+		s.pushWS(client, replay)
+	}
+
+	logInfo("ws.resumed", "last_seq", lastSeq, "latest_seq", latest, "replayed", len(replays))
+	response.OK = true
+	response.Data = map[string]any{"replayed": len(replays), "latest_seq": latest}
+	return response
+}
+
+// resumeGapTooLarge reports whether events after lastSeq have already left
+// the buffer. A lastSeq ahead of the server means the buffer was reset.
+func resumeGapTooLarge(lastSeq, oldest, latest int64) bool {
+	return (oldest > 0 && lastSeq < oldest-1) || lastSeq > latest
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The protocol version is bumped whenever a message changes incompatibly.
+// Clients that never send hello are treated as version 1.
+const (
+	wsTypeHello = "hello"
+
+	wsProtocolVersion    = 1
+	wsMinProtocolVersion = 1
+	wsMaxBatchItems      = 100
+
+	maxRejectedHandshakes = 10
+)
+
+// wsRequestTypes lists the client message types the server understands.
+var wsRequestTypes = []string{
+	wsTypeHello,
+	wsTypeHeartbeat,
+	wsTypeSubscribe,
+	wsTypeUnsubscribe,
+	wsTypeStudiesRefresh,
+	wsTypeInterceptedResponse,
+	wsTypeStudiesResponse,
+	wsTypeSubmission,
+	wsTypeParticipantSubs,
+	wsTypeDebugState,
+	wsTypeBatch,
+	wsTypeQueryStudies,
+	wsTypeQueryEvents,
+	wsTypeQuerySubmissions,
+	wsTypeQueryStatus,
+}
+
+// wsEventTypes lists the messages the server pushes without a request.
+var wsEventTypes = []string{
+	wsTypeStudiesRefreshEvent,
+	wsTypeBalanceChangedEvent,
+	wsTypeAvailabilityEvent,
+	wsTypeSubmissionUpdate,
+	wsTypePriorityMatchEvent,
+	wsTypeRefreshLead,
+	wsTypeRefreshStandby,
+}
+
+type wsHelloPayload struct {
+	ProtocolVersion  int      `json:"protocol_version"`
+	ExtensionVersion string   `json:"extension_version"`
+	Capabilities     []string `json:"capabilities"`
+}
+
+// wsClientHello is what a client announced about itself.
+type wsClientHello struct {
+	ProtocolVersion  int       `json:"protocol_version"`
+	ExtensionVersion string    `json:"extension_version,omitempty"`
+	Capabilities     []string  `json:"capabilities"`
+	At               time.Time `json:"at"`
+}
+
+type wsRejectedHandshake struct {
+	wsClientHello
+	Reason string `json:"reason"`
+}
+
+type wsHandshakes struct {
+	mu       sync.Mutex
+	rejected []wsRejectedHandshake
+	total    int
+}
+
+func (h *wsHandshakes) reject(hello wsClientHello, reason string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.total++
+	h.rejected = append(h.rejected, wsRejectedHandshake{wsClientHello: hello, Reason: reason})
+	if overflow := len(h.rejected) - maxRejectedHandshakes; overflow > 0 {
+		h.rejected = append([]wsRejectedHandshake(nil), h.rejected[overflow:]...)
+	}
+}
+
+func (h *wsHandshakes) snapshot() (int, []wsRejectedHandshake) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.total, append([]wsRejectedHandshake{}, h.rejected...)
+}
+
+func (s *Service) wsFeatureFlags() map[string]bool {
+	return map[string]bool{
+		"intercept_routing":    true,
+		"pagination_sessions":  true,
+		"mass_drop_guard":      s.config.MassDrop.enabled(),
+		"raw_capture":          s.capturesStore != nil,
+		"schema_drift":         s.schemaDriftStore != nil,
+		"rejected_items":       true,
+		"topics":               true,
+		"resume":               s.wsEventsStore != nil,
+		"batch":                true,
+		"queries":              true,
+		"refresh_coordination": true,
+	}
+}
+
+// handleWSHello records the client's hello and builds the reply. A non-empty
+// second result is the close reason for an incompatible client.
+func (s *Service) handleWSHello(client *wsConnClient, request wsClientMessage) (wsServerMessage, string) {
+	response := wsServerMessage{Type: wsTypeAck, ID: strings.TrimSpace(request.ID)}
+
+	var payload wsHelloPayload
+	if err := decodeWSPayload(request.Payload, &payload, true); err != nil {
+		response.Error = wsErrorMessage(err)
+		return response, ""
+	}
+
+	hello := wsClientHello{
+		ProtocolVersion:  payload.ProtocolVersion,
+		ExtensionVersion: strings.TrimSpace(payload.ExtensionVersion),
+		Capabilities:     payload.Capabilities,
+		At:               time.Now().UTC(),
+	}
+	if hello.Capabilities == nil {
+		hello.Capabilities = []string{}
+	}
+
+	if hello.ProtocolVersion < wsMinProtocolVersion || hello.ProtocolVersion > wsProtocolVersion {
+		reason := fmt.Sprintf(
+			"unsupported protocol version %d (server supports %d-%d)",
+			hello.ProtocolVersion, wsMinProtocolVersion, wsProtocolVersion,
+		)
+		s.wsHandshakes.reject(hello, reason)
+		logWarn("ws.hello_rejected", "protocol_version", hello.ProtocolVersion, "extension_version", hello.ExtensionVersion, "reason", reason)
+		response.Error = reason
+		return response, reason
+	}
+
+	client.setHello(hello)
+	logInfo("ws.hello", "protocol_version", hello.ProtocolVersion, "extension_version", hello.ExtensionVersion, "capabilities", strings.Join(hello.Capabilities, ","))
+
+	data := map[string]any{
+		"protocol_version":     wsProtocolVersion,
+		"min_protocol_version": wsMinProtocolVersion,
+		"supported_types":      wsRequestTypes,
+		"event_types":          wsEventTypes,
+		"limits": map[string]any{
+			"read_limit_bytes": wsReadLimitBytes,
+			"max_batch":        wsMaxBatchItems,
+		},
+		"topics":   wsTopics,
+		"features": s.wsFeatureFlags(),
+	}
+	if s.wsEventsStore != nil {
+		if _, latest, err := s.wsEventsStore.Bounds(); err == nil {
+			data["latest_seq"] = latest
+		}
+	}
+
+	response.OK = true
+	response.Data = data
+	return response, ""
+}
+
+// wsStatus summarizes connected clients and rejected handshakes for /status.
+func (s *Service) wsStatus() map[string]any {
+	clients := s.snapshotWSClients()
+	hellos := make([]wsClientHello, 0, len(clients))
+	queues := make([]wsQueueStats, 0, len(clients))
+	var dropped, coalesced int64
+	for _, client := range clients {
+		if hello := client.getHello(); hello != nil {
+			hellos = append(hellos, *hello)
+		}
+		stats := client.outbound.stats()
+		queues = append(queues, stats)
+		dropped += stats.Dropped
+		coalesced += stats.Coalesced
+	}
+
+	rejectedTotal, rejected := s.wsHandshakes.snapshot()
+	return map[string]any{
+		"protocol_version":     wsProtocolVersion,
+		"min_protocol_version": wsMinProtocolVersion,
+		"connected_clients":    len(clients),
+		"clients":              hellos,
+		"rejected_handshakes":  rejectedTotal,
+		"recent_rejected":      rejected,
+		"queues":               queues,
+		"queue_totals": map[string]any{
+			"dropped":                   dropped,
+			"coalesced":                 coalesced,
+			"slow_consumer_disconnects": s.wsSlowDisconnects.Load(),
+		},
+	}
+}
+
+func (c *wsConnClient) setHello(hello wsClientHello) {
+	c.helloMu.Lock()
+	c.hello = &hello
+	c.helloMu.Unlock()
+}
+
+func (c *wsConnClient) getHello() *wsClientHello {
+	c.helloMu.Lock()
+	defer c.helloMu.Unlock()
+	return c.hello
+}
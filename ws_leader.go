@@ -0,0 +1,178 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Only one connected extension should poll Prolific at a time. Clients that
+// announce wsCapabilityRefreshCoordination in hello take part in the
+// election; the others keep refreshing on their own as before.
+const (
+	wsTypeRefreshLead    = "refresh-lead"
+	wsTypeRefreshStandby = "refresh-standby"
+
+	wsCapabilityRefreshCoordination = "refresh-coordination"
+
+	defaultRefreshLeaderTimeout = 60 * time.Second
+)
+
+type refreshRole int
+
+const (
+	refreshRoleNone refreshRole = iota
+	refreshRoleLead
+	refreshRoleStandby
+)
+
+type refreshLeadership struct {
+	mu     sync.Mutex
+	leader *wsConnClient
+	since  time.Time
+	term   int64
+	roles  map[*wsConnClient]refreshRole
+}
+
+func wantsRefreshCoordination(hello wsClientHello) bool {
+	return slices.Contains(hello.Capabilities, wsCapabilityRefreshCoordination)
+}
+
+// lastHeard is when the client last sent a message. Pongs do not count: a
+// leader whose refresh loop stalled still answers pings.
+func (c *wsConnClient) lastHeard() time.Time {
+	if last := unixNanoTime(c.activity.lastMessageAt.Load()); last != nil {
+		return *last
+	}
+	return c.info.ConnectedAt
+}
+
+// trackRefreshElection runs after every message from client. It enrolls or
+// drops the client according to its hello, fails over when the leader has
+// gone quiet and elects a leader when there is none. Because it runs on
+// every message, a standby's heartbeats are what notice a dead leader.
+func (s *Service) trackRefreshElection(client *wsConnClient) {
+	hello := client.getHello()
+	if hello == nil || !wantsRefreshCoordination(*hello) {
+		s.leaveRefreshElection(client)
+		return
+	}
+
+	l := &s.refreshLeadership
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.roles == nil {
+		l.roles = make(map[*wsConnClient]refreshRole)
+	}
+	reason := "leader_stale"
+	if _, ok := l.roles[client]; !ok {
+		l.roles[client] = refreshRoleNone
+		reason = "joined"
+	}
+
+	now := time.Now()
+	if l.leader != nil && now.Sub(l.leader.lastHeard()) > s.config.RefreshLeaderTimeout {
+		logWarn("ws.refresh_leader_stale", "client_id", l.leader.info.ID, "last_heard_at", l.leader.lastHeard().UTC().Format(time.RFC3339Nano))
+		l.roles[l.leader] = refreshRoleNone
+		l.leader = nil
+	}
+	s.electRefreshLeaderLocked(now, reason)
+}
+
+// leaveRefreshElection drops a client and fails over if it was the leader.
+func (s *Service) leaveRefreshElection(client *wsConnClient) {
+	l := &s.refreshLeadership
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.roles[client]; !ok {
+		return
+	}
+	delete(l.roles, client)
+	if l.leader == client {
+		l.leader = nil
+		s.electRefreshLeaderLocked(time.Now(), "leader_left")
+	}
+}
+
+// electRefreshLeaderLocked picks the longest-connected live client when
+// there is no leader, then tells every participant whose role changed.
+func (s *Service) electRefreshLeaderLocked(now time.Time, reason string) {
+	l := &s.refreshLeadership
+
+	if l.leader == nil {
+		var candidate *wsConnClient
+		for client := range l.roles {
+			if now.Sub(client.lastHeard()) > s.config.RefreshLeaderTimeout {
+				continue
+			}
+			if candidate == nil || client.info.ID < candidate.info.ID {
+				candidate = client
+			}
+		}
+		if candidate == nil {
+			return
+		}
+		l.leader = candidate
+		l.since = now.UTC()
+		l.term++
+		logInfo("ws.refresh_leader_elected", "client_id", candidate.info.ID, "term", l.term, "reason", reason)
+	}
+
+	for client, role := range l.roles {
+		want := refreshRoleStandby
+		messageType := wsTypeRefreshStandby
+		if client == l.leader {
+			want = refreshRoleLead
+			messageType = wsTypeRefreshLead
+		}
+		if role == want {
+			continue
+		}
+		l.roles[client] = want
+		s.sendWS(client, wsServerMessage{
+			Type: messageType,
+			Data: map[string]any{
+				"term":             l.term,
+				"leader_client_id": l.leader.info.ID,
+				"leader_since":     l.since,
+			},
+			At: now.UTC().Format(time.RFC3339Nano),
+		})
+	}
+}
+
+type refreshLeaderStatus struct {
+	ClientID         int64     `json:"client_id"`
+	RemoteAddr       string    `json:"remote_addr"`
+	ExtensionVersion string    `json:"extension_version,omitempty"`
+	Since            time.Time `json:"since"`
+	LastHeardAt      time.Time `json:"last_heard_at"`
+}
+
+func (s *Service) refreshLeaderStatus() map[string]any {
+	l := &s.refreshLeadership
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	status := map[string]any{
+		"term":         l.term,
+		"participants": len(l.roles),
+		"timeout":      s.config.RefreshLeaderTimeout.String(),
+		"leader":       nil,
+	}
+	if l.leader != nil {
+		leader := refreshLeaderStatus{
+			ClientID:    l.leader.info.ID,
+			RemoteAddr:  l.leader.info.RemoteAddr,
+			Since:       l.since,
+			LastHeardAt: l.leader.lastHeard().UTC(),
+		}
+		if hello := l.leader.getHello(); hello != nil {
+			leader.ExtensionVersion = hello.ExtensionVersion
+		}
+		status["leader"] = leader
+	}
+	return status
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+const (
+	wsTypeQueryStudies     = "query-studies"
+	wsTypeQueryEvents      = "query-events"
+	wsTypeQuerySubmissions = "query-submissions"
+	wsTypeQueryStatus      = "query-status"
+)
+
+// wsQueryTypes read state instead of ingesting it; their acks are not kept
+// in the dedupe cache.
+var wsQueryTypes = []string{
+	wsTypeQueryStudies,
+	wsTypeQueryEvents,
+	wsTypeQuerySubmissions,
+	wsTypeQueryStatus,
+}
+
+// wsQueryValues turns a query message payload such as {"limit": 20,
+// "phase": "submitted"} into the query parameters the HTTP handler takes.
+func wsQueryValues(payload json.RawMessage) (url.Values, error) {
+	values := url.Values{}
+	trimmed := bytes.TrimSpace(payload)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return values, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	decoder.UseNumber()
+	var params map[string]any
+	if err := decoder.Decode(&params); err != nil {
+		return nil, badRequest("payload must be an object of query parameters")
+	}
+	for key, value := range params {
+		switch typed := value.(type) {
+		case nil:
+		case string, json.Number, bool:
+			values.Set(key, fmt.Sprint(typed))
+		default:
+			return nil, badRequest(fmt.Sprintf("query parameter %q must be a string, number or boolean", key))
+		}
+	}
+	return values, nil
+}
+
+func (s *Service) dispatchWSQuery(requestType string, payload json.RawMessage) (map[string]any, error) {
+	query, err := wsQueryValues(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	switch requestType {
+	case wsTypeQueryStudies:
+		return s.queryStudies(query)
+	case wsTypeQueryEvents:
+		return s.queryStudyEvents(query)
+	case wsTypeQuerySubmissions:
+		return s.querySubmissions(query)
+	default:
+		return s.queryStatus()
+	}
+}
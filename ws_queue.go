@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// Slow-consumer policies, applied when a client's send queue is full and
+// another broadcast arrives. Replies to the client's own requests are never
+// dropped.
+const (
+	wsSlowConsumerDropOldest = "drop_oldest"
+	wsSlowConsumerCoalesce   = "coalesce"
+	wsSlowConsumerDisconnect = "disconnect"
+
+	defaultWSQueueSize          = 256
+	defaultWSSlowConsumerPolicy = wsSlowConsumerCoalesce
+)
+
+var wsSlowConsumerPolicies = []string{wsSlowConsumerDropOldest, wsSlowConsumerCoalesce, wsSlowConsumerDisconnect}
+
+type wsQueuedMessage struct {
+	message   wsServerMessage
+	droppable bool
+}
+
+// wsOutbound is a client's bounded send queue, drained by runWSWriter.
+type wsOutbound struct {
+	mu       sync.Mutex
+	queue    []wsQueuedMessage
+	size     int
+	policy   string
+	closed   bool
+	maxDepth int
+
+	notify chan struct{}
+	done   chan struct{}
+
+	sent      atomic.Int64
+	dropped   atomic.Int64
+	coalesced atomic.Int64
+}
+
+func newWSOutbound(size int, policy string) *wsOutbound {
+	if size < 1 {
+		size = defaultWSQueueSize
+	}
+	return &wsOutbound{
+		size:   size,
+		policy: policy,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+type wsQueueStats struct {
+	Depth     int    `json:"depth"`
+	MaxDepth  int    `json:"max_depth"`
+	Capacity  int    `json:"capacity"`
+	Policy    string `json:"policy"`
+	Sent      int64  `json:"sent"`
+	Dropped   int64  `json:"dropped"`
+	Coalesced int64  `json:"coalesced"`
+}
+
+// enqueue adds message to the queue. It returns false when the queue is full
+// and the policy is to disconnect the client.
+func (q *wsOutbound) enqueue(message wsServerMessage, droppable bool) bool {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return true
+	}
+
+	if droppable && len(q.queue) >= q.size {
+		switch q.policy {
+		case wsSlowConsumerDisconnect:
+			q.mu.Unlock()
+			return false
+		case wsSlowConsumerCoalesce:
+			if message.Type == wsTypeStudiesRefreshEvent {
+				q.removeDroppableLocked(func(queued wsServerMessage) bool {
+					return queued.Type == wsTypeStudiesRefreshEvent
+				}, &q.coalesced)
+			}
+		}
+		if len(q.queue) >= q.size {
+			q.removeDroppableLocked(nil, &q.dropped)
+		}
+	}
+
+	q.queue = append(q.queue, wsQueuedMessage{message: message, droppable: droppable})
+	if len(q.queue) > q.maxDepth {
+		q.maxDepth = len(q.queue)
+	}
+	q.mu.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// removeDroppableLocked removes droppable queued messages that match, or
+// only the oldest droppable one when match is nil.
+func (q *wsOutbound) removeDroppableLocked(match func(wsServerMessage) bool, counter *atomic.Int64) {
+	kept := q.queue[:0]
+	removedOne := false
+	for _, queued := range q.queue {
+		remove := queued.droppable && (match == nil && !removedOne || match != nil && match(queued.message))
+		if remove {
+			removedOne = true
+			counter.Add(1)
+			continue
+		}
+		kept = append(kept, queued)
+	}
+	q.queue = kept
+}
+
+func (q *wsOutbound) dequeueAll() []wsQueuedMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending := q.queue
+	q.queue = nil
+	return pending
+}
+
+// close stops accepting messages; the writer drains what is queued and exits.
+func (q *wsOutbound) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *wsOutbound) stats() wsQueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return wsQueueStats{
+		Depth:     len(q.queue),
+		MaxDepth:  q.maxDepth,
+		Capacity:  q.size,
+		Policy:    q.policy,
+		Sent:      q.sent.Load(),
+		Dropped:   q.dropped.Load(),
+		Coalesced: q.coalesced.Load(),
+	}
+}
+
+// runWSWriter is the only goroutine that writes to client's connection.
+func (s *Service) runWSWriter(ctx context.Context, client *wsConnClient) {
+	out := client.outbound
+	defer close(out.done)
+
+	for {
+		select {
+		case <-out.notify:
+		case <-ctx.Done():
+			return
+		}
+
+		for _, queued := range out.dequeueAll() {
+			writeCtx, cancel := context.WithTimeout(ctx, wsWriteTimeout)
+			err := wsjson.Write(writeCtx, client.conn, queued.message)
+			cancel()
+			if err != nil {
+				logWarn("ws.write_failed", "type", queued.message.Type, "error", err)
+				_ = client.conn.Close(websocket.StatusInternalError, "write failed")
+				return
+			}
+			out.sent.Add(1)
+		}
+
+		out.mu.Lock()
+		drained := out.closed && len(out.queue) == 0
+		out.mu.Unlock()
+		if drained {
+			return
+		}
+	}
+}
+
+// sendWS queues a reply to the client's own request.
+func (s *Service) sendWS(client *wsConnClient, message wsServerMessage) {
+	client.outbound.enqueue(message, false)
+}
+
+// pushWS queues a broadcast, applying the slow-consumer policy.
+func (s *Service) pushWS(client *wsConnClient, message wsServerMessage) {
+	if client.outbound.enqueue(message, true) {
+		return
+	}
+
+	s.wsSlowDisconnects.Add(1)
+	logWarn("ws.slow_consumer_disconnected", "client_id", client.info.ID, "type", message.Type, "queue_size", client.outbound.size)
+	closeWSClient(client, websocket.StatusPolicyViolation, "slow consumer")
+}
+
+// stopWSWriter lets the writer flush queued replies, waiting at most one
+// write timeout.
+func stopWSWriter(client *wsConnClient) {
+	client.outbound.close()
+	select {
+	case <-client.outbound.done:
+	case <-time.After(wsWriteTimeout):
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	wsTypeSubscribe   = "subscribe"
+	wsTypeUnsubscribe = "unsubscribe"
+
+	wsTypeAvailabilityEvent  = "availability_event"
+	wsTypeSubmissionUpdate   = "submission_update"
+	wsTypePriorityMatchEvent = "priority_match_event"
+
+	wsTopicStudies      = "studies"
+	wsTopicAvailability = "availability"
+	wsTopicSubmissions  = "submissions"
+	wsTopicBalance      = "balance"
+	wsTopicPriority     = "priority"
+)
+
+var wsTopics = []string{
+	wsTopicStudies,
+	wsTopicAvailability,
+	wsTopicSubmissions,
+	wsTopicBalance,
+	wsTopicPriority,
+}
+
+// wsDefaultTopics is what a client receives until it subscribes explicitly,
+// matching the events pushed before topics existed.
+var wsDefaultTopics = []string{wsTopicStudies, wsTopicBalance}
+
+type wsSubscriptionPayload struct {
+	Topics []string `json:"topics"`
+}
+
+// subscribed reports whether the client wants events on topic.
+func (c *wsConnClient) subscribed(topic string) bool {
+	c.topicsMu.Lock()
+	defer c.topicsMu.Unlock()
+
+	if c.topics == nil {
+		return slices.Contains(wsDefaultTopics, topic)
+	}
+	_, ok := c.topics[topic]
+	return ok
+}
+
+// updateTopics applies a subscribe or unsubscribe and returns the resulting
+// topic list. The first call replaces the default topics.
+func (c *wsConnClient) updateTopics(topics []string, subscribe bool) []string {
+	c.topicsMu.Lock()
+	defer c.topicsMu.Unlock()
+
+	if c.topics == nil {
+		c.topics = make(map[string]struct{})
+		if !subscribe {
+			for _, topic := range wsDefaultTopics {
+				c.topics[topic] = struct{}{}
+			}
+		}
+	}
+	for _, topic := range topics {
+		if subscribe {
+			c.topics[topic] = struct{}{}
+		} else {
+			delete(c.topics, topic)
+		}
+	}
+
+	return c.sortedTopicsLocked()
+}
+
+// currentTopics returns the topics the client receives, defaults included.
+func (c *wsConnClient) currentTopics() []string {
+	c.topicsMu.Lock()
+	defer c.topicsMu.Unlock()
+
+	if c.topics == nil {
+		return slices.Clone(wsDefaultTopics)
+	}
+	return c.sortedTopicsLocked()
+}
+
+func (c *wsConnClient) sortedTopicsLocked() []string {
+	current := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		current = append(current, topic)
+	}
+	slices.Sort(current)
+	return current
+}
+
+func (s *Service) handleWSSubscription(client *wsConnClient, request wsClientMessage) wsServerMessage {
+	requestType := strings.TrimSpace(request.Type)
+	response := wsServerMessage{Type: wsTypeAck, ID: strings.TrimSpace(request.ID)}
+
+	var payload wsSubscriptionPayload
+	if err := decodeWSPayload(request.Payload, &payload, true); err != nil {
+		response.Error = wsErrorMessage(err)
+		return response
+	}
+	if len(payload.Topics) == 0 {
+		response.Error = "topics cannot be empty"
+		return response
+	}
+
+	topics := make([]string, 0, len(payload.Topics))
+	for _, raw := range payload.Topics {
+		topic := strings.ToLower(strings.TrimSpace(raw))
+		if !slices.Contains(wsTopics, topic) {
+			response.Error = fmt.Sprintf("unknown topic %q; expected one of: %s", raw, strings.Join(wsTopics, ", "))
+			return response
+		}
+		topics = append(topics, topic)
+	}
+
+	current := client.updateTopics(topics, requestType == wsTypeSubscribe)
+	logInfo("ws.topics_updated", "type", requestType, "topics", strings.Join(current, ","))
+
+	response.OK = true
+	response.Data = map[string]any{"topics": current}
+	return response
+}
+
+func (s *Service) broadcastSubmissionUpdate(update SubmissionUpdateResult) {
+	s.broadcastWSEvent(wsTopicSubmissions, wsServerMessage{
+		Type: wsTypeSubmissionUpdate,
+		Data: update,
+		At:   update.ObservedAt.Format(time.RFC3339Nano),
+	})
+}
+
+func (s *Service) broadcastAvailabilityEvent(summary StudyAvailabilitySummary) {
+	if len(summary.NewlyAvailable) == 0 && len(summary.Reopened) == 0 &&
+		len(summary.BecameUnavailable) == 0 && len(summary.Updated) == 0 {
+		return
+	}
+	s.broadcastWSEvent(wsTopicAvailability, wsServerMessage{
+		Type: wsTypeAvailabilityEvent,
+		Data: summary,
+		At:   summary.ObservedAt.Format(time.RFC3339Nano),
+	})
+}
+
+// broadcastPriorityMatches pushes newly announced studies that pass the
+// configured priority filter.
+func (s *Service) broadcastPriorityMatches(studies []normalizedStudy, observedAt time.Time) {
+	matches := make([]normalizedStudy, 0)
+	for _, study := range studies {
+		if s.config.PriorityFilter.Matches(study) {
+			matches = append(matches, study)
+		}
+	}
+	if len(matches) == 0 {
+		return
+	}
+	s.broadcastWSEvent(wsTopicPriority, wsServerMessage{
+		Type: wsTypePriorityMatchEvent,
+		Data: map[string]any{
+			"studies": matches,
+			"filter":  s.config.PriorityFilter,
+		},
+		At: observedAt.Format(time.RFC3339Nano),
+	})
+}